@@ -0,0 +1,183 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/luigiacunaUB/cmps4191-test-3/internal/data"
+	"github.com/luigiacunaUB/cmps4191-test-3/internal/validator"
+)
+
+// ------------------------------------------------------------------------------------------------------------------------------
+func (a *applicationDependencies) exportAccountHandler(w http.ResponseWriter, r *http.Request) {
+	// Everything we hold about the user in one JSON document they can keep
+	user, err := a.currentUser(r)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	permissions, err := a.PermissionModel.GetAllForUser(user.ID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	reviews, err := a.allReviewsForUser(user.ID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	readingLists, err := a.ReadingListModel.GetOwnedReadingLists(user.ID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	following, err := a.ReadingListModel.GetFollowedReadingLists(user.ID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	goals, err := a.ReadingGoalModel.GetAllForUser(user.ID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	apiKeys, err := a.APIKeyModel.GetAllForUser(user.ID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	identities, err := a.IdentityModel.GetAllForUser(user.ID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	twoFactorEnabled, err := a.TwoFactorModel.IsEnabled(user.ID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if permissions == nil {
+		permissions = data.Permissions{}
+	}
+
+	archive := envelope{
+		"exported_at":   time.Now().UTC(),
+		"user":          user,
+		"permissions":   permissions,
+		"reviews":       reviews,
+		"reading_lists": readingLists,
+		"following":     following,
+		"reading_goals": goals,
+		"api_keys":      apiKeys,
+		"identities":    identities,
+		"two_factor":    envelope{"enabled": twoFactorEnabled},
+	}
+
+	headers := make(http.Header)
+	headers.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="user_%d_export.json"`, user.ID))
+
+	err = a.writeJSON(w, http.StatusOK, envelope{"export": archive}, headers)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// allReviewsForUser pages through every review the user wrote, oldest first
+func (a *applicationDependencies) allReviewsForUser(userID int64) ([]data.Review, error) {
+	filters := data.Filters{
+		PageSize:     100,
+		Sort:         "id",
+		SortSafeList: []string{"id"},
+	}
+
+	reviews := []data.Review{}
+	for filters.Page = 1; ; filters.Page++ {
+		page, metadata, err := a.ReviewModel.GetAllForUser(userID, filters)
+		if err != nil {
+			return nil, err
+		}
+		reviews = append(reviews, page...)
+		if filters.Page >= metadata.LastPage {
+			return reviews, nil
+		}
+	}
+}
+
+// ------------------------------------------------------------------------------------------------------------------------------
+func (a *applicationDependencies) deleteAccountHandler(w http.ResponseWriter, r *http.Request) {
+	// mode decides what happens to the account, reviews what happens to the reviews the user wrote:
+	// kept reviews lose their author when the account is deleted and show "deleted user" when it is anonymized
+	var incomingData struct {
+		Password string `json:"password"`
+		Mode     string `json:"mode"`
+		Reviews  string `json:"reviews"`
+	}
+	err := a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(incomingData.Password != "", "password", "must be provided")
+	v.Check(validator.PermittedValue(incomingData.Mode, "delete", "anonymize"), "mode", "must be delete or anonymize")
+	v.Check(validator.PermittedValue(incomingData.Reviews, "keep", "delete"), "reviews", "must be keep or delete")
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := a.currentUser(r)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	match, err := user.Password.Matches(incomingData.Password)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+	if !match {
+		a.invalidCredentialsResponse(w, r)
+		return
+	}
+
+	keepReviews := incomingData.Reviews == "keep"
+	if incomingData.Mode == "anonymize" {
+		err = a.UserModel.AnonymizeAccount(user.ID, keepReviews)
+	} else {
+		err = a.UserModel.DeleteAccount(user.ID, keepReviews)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	a.sessionsRevoked()
+
+	message := "your account was deleted"
+	if incomingData.Mode == "anonymize" {
+		message = "your account was anonymized"
+	}
+
+	err = a.writeJSON(w, http.StatusOK, envelope{"message": message}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
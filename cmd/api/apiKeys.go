@@ -0,0 +1,136 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/luigiacunaUB/cmps4191-test-3/internal/data"
+	"github.com/luigiacunaUB/cmps4191-test-3/internal/validator"
+)
+
+// authenticateAPIKey handles "Authorization: ApiKey <key>". The request runs as the key's owner with only the
+// permissions the key was given.
+func (a *applicationDependencies) authenticateAPIKey(w http.ResponseWriter, r *http.Request, keyPlaintext string, next http.Handler) {
+	user, key, err := a.APIKeyModel.GetForKey(keyPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.invalidAPIKeyResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// A failed last-used update shouldn't fail the request itself
+	err = a.APIKeyModel.Touch(key)
+	if err != nil {
+		a.logger.Error(err.Error())
+	}
+
+	r = a.contextSetUser(r, user)
+	r = a.contextSetPermissions(r, key.Permissions)
+	r = a.contextSetAPIKeyID(r, key.ID)
+	next.ServeHTTP(w, r)
+}
+
+// requireInteractiveUser keeps API keys away from routes that manage credentials, so a leaked key can't be
+// used to mint more keys. requireAuthenticatedUser already refuses keys on routes without a permission, this
+// states it on the routes where letting one through would hurt most.
+func (a *applicationDependencies) requireInteractiveUser(next http.HandlerFunc) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		if a.contextGetAPIKeyID(r) != 0 {
+			a.apiKeyNotAllowedResponse(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+	return a.requireActivatedUser(fn)
+}
+
+// ------------------------------------------------------------------------------------------------------------------------------
+func (a *applicationDependencies) createAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	var incomingData struct {
+		Name        string     `json:"name"`
+		Permissions []string   `json:"permissions"`
+		ExpiresAt   *time.Time `json:"expires_at"`
+	}
+	err := a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := a.contextGetUser(r)
+	ownerPermissions, err := a.userPermissions(r)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	key := &data.APIKey{
+		UserID:      user.ID,
+		Name:        incomingData.Name,
+		Permissions: incomingData.Permissions,
+		ExpiresAt:   incomingData.ExpiresAt,
+	}
+
+	v := validator.New()
+	data.ValidateAPIKey(v, key, ownerPermissions)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = a.APIKeyModel.Insert(key)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// This is the only time the key is shown
+	err = a.writeJSON(w, http.StatusCreated, envelope{"api_key": key}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// ------------------------------------------------------------------------------------------------------------------------------
+func (a *applicationDependencies) listAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	keys, err := a.APIKeyModel.GetAllForUser(a.contextGetUser(r).ID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = a.writeJSON(w, http.StatusOK, envelope{"api_keys": keys}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// ------------------------------------------------------------------------------------------------------------------------------
+func (a *applicationDependencies) deleteAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	err = a.APIKeyModel.Delete(id, a.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = a.writeJSON(w, http.StatusOK, envelope{"message": "the API key was revoked"}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
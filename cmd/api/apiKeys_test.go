@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/luigiacunaUB/cmps4191-test-3/internal/data"
+)
+
+func TestAPIKeyScoping(t *testing.T) {
+	a := &applicationDependencies{}
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		apiKey  bool
+		want    int
+	}{
+		{"key on a permission it holds", a.requirePermission("books:read", ok), true, http.StatusOK},
+		{"key on a permission it lacks", a.requirePermission("books:write", ok), true, http.StatusForbidden},
+		{"key on an activated user route", a.requireActivatedUser(ok), true, http.StatusForbidden},
+		{"key on an authenticated user route", a.requireAuthenticatedUser(ok), true, http.StatusForbidden},
+		{"key on a credentials route", a.requireInteractiveUser(ok), true, http.StatusForbidden},
+		{"login on a permission route", a.requirePermission("books:read", ok), false, http.StatusOK},
+		{"login on an activated user route", a.requireActivatedUser(ok), false, http.StatusOK},
+		{"login on an authenticated user route", a.requireAuthenticatedUser(ok), false, http.StatusOK},
+		{"login on a credentials route", a.requireInteractiveUser(ok), false, http.StatusOK},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r = a.contextSetUser(r, &data.User{ID: 1, Username: "alice", Activated: true})
+		r = a.contextSetPermissions(r, data.Permissions{"books:read"})
+		if tt.apiKey {
+			r = a.contextSetAPIKeyID(r, 3)
+		}
+
+		w := httptest.NewRecorder()
+		tt.handler(w, r)
+		if w.Code != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, w.Code, tt.want)
+		}
+	}
+}
@@ -311,3 +311,74 @@ func (a *applicationDependencies) ListAllHandler(w http.ResponseWriter, r *http.
 	}
 
 }
+
+// -----------------------------------------------------------------------------------------------------------------------------------
+func (a *applicationDependencies) TopRatedBooksHandler(w http.ResponseWriter, r *http.Request) {
+	var filters data.Filters
+
+	queryParameters := r.URL.Query()
+
+	v := validator.New()
+	genre := a.getSingleQueryParameter(queryParameters, "genre", "")
+	period := a.getSingleQueryParameter(queryParameters, "period", "all")
+	from, to, err := parseRankingPeriod(period, time.Now())
+	if err != nil {
+		v.AddError("period", err.Error())
+	}
+
+	filters.Page = a.getSingleIntegerParameter(queryParameters, "page", 1, v)
+	filters.PageSize = a.getSingleIntegerParameter(queryParameters, "page_size", 10, v)
+	filters.Sort = a.getSingleQueryParameter(queryParameters, "sort", "-score")
+	filters.SortSafeList = []string{"score", "review_count", "-score", "-review_count"}
+
+	data.ValidateFilters(v, filters)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	prior := data.RatingPrior{
+		Mean:   a.config.ranking.priorMean,
+		Weight: a.config.ranking.priorWeight,
+	}
+	books, metadata, err := a.BookModel.GetTopRated(genre, from, to, prior, filters)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = a.writeJSON(w, http.StatusOK, envelope{"books": books, "@metadata": metadata}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// parseRankingPeriod turns the period parameter into a [from, to) window of review dates. It accepts
+// "all", "year" or "month" for the current calendar year or month, "2024" for a year and "2024-06" for a month
+func parseRankingPeriod(period string, now time.Time) (*time.Time, *time.Time, error) {
+	var from time.Time
+	var to time.Time
+
+	switch period {
+	case "all":
+		return nil, nil, nil
+	case "year":
+		from = time.Date(now.Year(), time.January, 1, 0, 0, 0, 0, time.UTC)
+		to = from.AddDate(1, 0, 0)
+	case "month":
+		from = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+		to = from.AddDate(0, 1, 0)
+	default:
+		if year, err := time.Parse("2006", period); err == nil {
+			from = year
+			to = from.AddDate(1, 0, 0)
+		} else if month, err := time.Parse("2006-01", period); err == nil {
+			from = month
+			to = from.AddDate(0, 1, 0)
+		} else {
+			return nil, nil, errors.New("must be all, year, month, a year (2024) or a month (2024-06)")
+		}
+	}
+
+	return &from, &to, nil
+}
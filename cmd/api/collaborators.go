@@ -0,0 +1,192 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/luigiacunaUB/cmps4191-test-3/internal/data"
+	"github.com/luigiacunaUB/cmps4191-test-3/internal/validator"
+)
+
+// ------------------------------------------------------------------------------------------------------------------------------------
+func (a *applicationDependencies) ListCollaboratorsHandler(w http.ResponseWriter, r *http.Request) {
+	// Only people the list is shared with can see who else it is shared with
+	list, role, ok := a.readingListForUser(w, r)
+	if !ok {
+		return
+	}
+	if role == "" {
+		a.notPermittedResponse(w, r)
+		return
+	}
+
+	collaborators, err := a.ReadingListModel.GetCollaborators(list.ID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	response := envelope{"collaborators": collaborators}
+
+	// Only the owner sees the addresses they invited
+	if role == data.RoleOwner {
+		invitations, err := a.ReadingListModel.GetInvitations(list.ID)
+		if err != nil {
+			a.serverErrorResponse(w, r, err)
+			return
+		}
+		response["invitations"] = invitations
+	}
+
+	err = a.writeJSON(w, http.StatusOK, response, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// ------------------------------------------------------------------------------------------------------------------------------------
+func (a *applicationDependencies) AddCollaboratorHandler(w http.ResponseWriter, r *http.Request) {
+	// Only the owner decides who a list is shared with
+	list, _, ok := a.readingListForUser(w, r)
+	if !ok {
+		return
+	}
+	if !list.IsOwner(a.contextGetUser(r).ID) {
+		a.notPermittedResponse(w, r)
+		return
+	}
+
+	// The user is invited by email address
+	var incomingData struct {
+		Email string `json:"email"`
+		Role  string `json:"role"`
+	}
+	err := a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+	if incomingData.Role == "" {
+		incomingData.Role = data.RoleViewer
+	}
+
+	v := validator.New()
+	data.ValidateEmail(v, incomingData.Email)
+	data.ValidateCollaboratorRole(v, incomingData.Role)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	owner, err := a.UserModel.Get(list.CreatedBy)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+	if strings.EqualFold(owner.Email, incomingData.Email) {
+		v.AddError("email", "the owner of a list can't be added as a collaborator")
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// The answer is the same whether or not the address has an account, so inviting can't be used to find
+	// out who is registered. The list only shows up for the invitee once they accept.
+	err = a.ReadingListModel.InviteCollaborator(list.ID, incomingData.Email, incomingData.Role)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	a.background(func() {
+		data := map[string]any{
+			"ownerName": owner.Username,
+			"listID":    list.ID,
+			"listName":  list.ReadListName,
+			"role":      incomingData.Role,
+		}
+		err := a.mailer.Send(incomingData.Email, "list_invitation.tmpl", data)
+		if err != nil {
+			a.logger.Error(err.Error())
+		}
+	})
+
+	err = a.writeJSON(w, http.StatusAccepted, envelope{
+		"message": "an invitation to collaborate was sent to the email address, the list is shared once it is accepted",
+	}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// ------------------------------------------------------------------------------------------------------------------------------------
+func (a *applicationDependencies) AcceptInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	// The list isn't visible to the invitee yet, so it is loaded without readingListForUser
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	user, err := a.currentUser(r)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	collaborator, err := a.ReadingListModel.AcceptInvitation(id, user.ID, user.Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = a.writeJSON(w, http.StatusOK, envelope{"collaborator": collaborator}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// ------------------------------------------------------------------------------------------------------------------------------------
+func (a *applicationDependencies) RemoveCollaboratorHandler(w http.ResponseWriter, r *http.Request) {
+	list, _, ok := a.readingListForUser(w, r)
+	if !ok {
+		return
+	}
+
+	userID, err := a.readNamedIDParam(r, "user_id")
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	// The owner can remove anyone, a collaborator can only take themselves off the list
+	currentUser := a.contextGetUser(r)
+	if !list.IsOwner(currentUser.ID) && currentUser.ID != userID {
+		a.notPermittedResponse(w, r)
+		return
+	}
+
+	err = a.ReadingListModel.RemoveCollaborator(list.ID, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = a.writeJSON(w, http.StatusOK, envelope{
+		"message": fmt.Sprintf("User %d removed from reading list %d", userID, list.ID),
+	}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/luigiacunaUB/cmps4191-test-3/internal/data"
+	"github.com/luigiacunaUB/cmps4191-test-3/internal/validator"
+)
+
+// filterContent runs user submitted text through the content filters. Rejected text adds a
+// validation error under key, the (possibly masked) text is returned with any flag reasons
+func (a *applicationDependencies) filterContent(v *validator.Validator, key string, text string) (string, []string) {
+	result := a.contentFilter.Run(text)
+	if result.Rejected {
+		v.AddError(key, fmt.Sprintf("contains content that is not allowed (%s)", strings.Join(result.Reasons, ", ")))
+		return result.Text, nil
+	}
+	if result.Flagged {
+		return result.Text, result.Reasons
+	}
+	return result.Text, nil
+}
+
+// flagContent puts saved content in the moderation queue, the content is already stored
+// so a failure is only logged
+func (a *applicationDependencies) flagContent(r *http.Request, contentType string, contentID int64, reasons []string) {
+	if len(reasons) == 0 {
+		return
+	}
+	flag := &data.ContentFlag{
+		ContentType: contentType,
+		ContentID:   contentID,
+		Reasons:     reasons,
+	}
+	err := a.ContentFlagModel.Insert(flag)
+	if err != nil {
+		a.logError(r, err)
+	}
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------
+func (a *applicationDependencies) ListContentFlagsHandler(w http.ResponseWriter, r *http.Request) {
+	var filters data.Filters
+
+	queryParameters := r.URL.Query()
+
+	v := validator.New()
+	filters.Page = a.getSingleIntegerParameter(queryParameters, "page", 1, v)
+	filters.PageSize = a.getSingleIntegerParameter(queryParameters, "page_size", 10, v)
+	filters.Sort = a.getSingleQueryParameter(queryParameters, "sort", "created_at")
+	filters.SortSafeList = []string{"created_at", "-created_at"}
+
+	data.ValidateFilters(v, filters)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	flags, metadata, err := a.ContentFlagModel.GetAllOpen(filters)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = a.writeJSON(w, http.StatusOK, envelope{"flags": flags, "@metadata": metadata}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------
+func (a *applicationDependencies) ResolveContentFlagHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	err = a.ContentFlagModel.Resolve(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = a.writeJSON(w, http.StatusOK, envelope{"message": "flag resolved"}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
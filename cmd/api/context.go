@@ -10,12 +10,19 @@ import (
 type contextKey string
 
 const userContextKey = contextKey("user")
+const sessionContextKey = contextKey("session")
+const permissionsContextKey = contextKey("permissions")
+const apiKeyContextKey = contextKey("api_key")
+const claimsUserContextKey = contextKey("claims_user")
+const permissionRouteContextKey = contextKey("permission_route")
 
 func (a *applicationDependencies) contextSetUser(r *http.Request, user *data.User) *http.Request {
 	ctx := context.WithValue(r.Context(), userContextKey, user)
     return r.WithContext(ctx)
 }
 
+// contextGetUser returns the user the request was made by. A user built from JWT claims only has its ID,
+// Username and Activated fields set, use currentUser when anything else is needed.
 func (a *applicationDependencies) contextGetUser(r *http.Request) *data.User {
     user, ok := r.Context().Value(userContextKey).(*data.User)
     if !ok {
@@ -24,3 +31,63 @@ func (a *applicationDependencies) contextGetUser(r *http.Request) *data.User {
 
     return user
 }
+
+// contextSetSessionID stores the id of the authentication token the request was made with
+func (a *applicationDependencies) contextSetSessionID(r *http.Request, id int64) *http.Request {
+	ctx := context.WithValue(r.Context(), sessionContextKey, id)
+	return r.WithContext(ctx)
+}
+
+// contextGetSessionID returns the id stored by contextSetSessionID, or 0 for anonymous requests
+func (a *applicationDependencies) contextGetSessionID(r *http.Request) int64 {
+	id, _ := r.Context().Value(sessionContextKey).(int64)
+	return id
+}
+
+// contextSetPermissions stores permissions that came with the access token, so they don't have to be looked up
+func (a *applicationDependencies) contextSetPermissions(r *http.Request, permissions data.Permissions) *http.Request {
+	ctx := context.WithValue(r.Context(), permissionsContextKey, permissions)
+	return r.WithContext(ctx)
+}
+
+// contextGetPermissions returns the permissions stored by contextSetPermissions, ok is false when there are none
+func (a *applicationDependencies) contextGetPermissions(r *http.Request) (data.Permissions, bool) {
+	permissions, ok := r.Context().Value(permissionsContextKey).(data.Permissions)
+	return permissions, ok
+}
+
+// contextSetAPIKeyID marks the request as authenticated with an API key
+func (a *applicationDependencies) contextSetAPIKeyID(r *http.Request, id int64) *http.Request {
+	ctx := context.WithValue(r.Context(), apiKeyContextKey, id)
+	return r.WithContext(ctx)
+}
+
+// contextGetAPIKeyID returns the id of the API key the request was made with, or 0
+func (a *applicationDependencies) contextGetAPIKeyID(r *http.Request) int64 {
+	id, _ := r.Context().Value(apiKeyContextKey).(int64)
+	return id
+}
+
+// contextSetPermissionRoute marks the request as being for a route that requires a permission
+func (a *applicationDependencies) contextSetPermissionRoute(r *http.Request) *http.Request {
+	ctx := context.WithValue(r.Context(), permissionRouteContextKey, true)
+	return r.WithContext(ctx)
+}
+
+// contextIsPermissionRoute reports whether the route requires a permission, only those routes take API keys
+func (a *applicationDependencies) contextIsPermissionRoute(r *http.Request) bool {
+	permissionRoute, _ := r.Context().Value(permissionRouteContextKey).(bool)
+	return permissionRoute
+}
+
+// contextSetClaimsUser stores a user that was built from the claims of a JWT rather than read from the database
+func (a *applicationDependencies) contextSetClaimsUser(r *http.Request, user *data.User) *http.Request {
+	ctx := context.WithValue(r.Context(), claimsUserContextKey, true)
+	return a.contextSetUser(r.WithContext(ctx), user)
+}
+
+// contextHasClaimsUser reports whether the request's user only holds what its JWT said
+func (a *applicationDependencies) contextHasClaimsUser(r *http.Request) bool {
+	claimsUser, _ := r.Context().Value(claimsUserContextKey).(bool)
+	return claimsUser
+}
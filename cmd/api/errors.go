@@ -73,6 +73,21 @@ func (a *applicationDependencies) invalidAuthenticationTokenResponse(w http.Resp
 
 }
 
+func (a *applicationDependencies) invalidAPIKeyResponse(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", "ApiKey")
+	a.errorResponseJSON(w, r, http.StatusUnauthorized, "invalid, expired or revoked API key")
+}
+
+func (a *applicationDependencies) twoFactorLockedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "too many wrong codes, wait a few minutes before trying again"
+	a.errorResponseJSON(w, r, http.StatusTooManyRequests, message)
+}
+
+func (a *applicationDependencies) apiKeyNotAllowedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "API keys can't be used to manage the account, its sessions or its credentials, log in instead"
+	a.errorResponseJSON(w, r, http.StatusForbidden, message)
+}
+
 func (a *applicationDependencies) authenticationRequiredResponse(w http.ResponseWriter, r *http.Request) {
 	message := "you must be authenticated to access this resource"
 	a.errorResponseJSON(w, r, http.StatusUnauthorized, message)
@@ -93,8 +108,7 @@ func (a *applicationDependencies) notPermittedResponse(w http.ResponseWriter,
 func (a *applicationDependencies) requirePermission(permissionCode string, next http.HandlerFunc)http.HandlerFunc { 
      
    fn := func(w http.ResponseWriter, r *http.Request) {
-       user := a.contextGetUser(r)
-       permissions, err := a.PermissionModel.GetAllForUser(user.ID)
+       permissions, err := a.userPermissions(r)
         if err != nil {
             a.serverErrorResponse(w, r, err)
             return
@@ -103,8 +117,28 @@ func (a *applicationDependencies) requirePermission(permissionCode string, next
             a.notPermittedResponse(w, r)
             return
    }
+		required, err := a.twoFactorRequired(permissionCode)
+		if err != nil {
+			a.serverErrorResponse(w, r, err)
+			return
+		}
+		if required {
+			enabled, err := a.TwoFactorModel.IsEnabled(a.contextGetUser(r).ID)
+			if err != nil {
+				a.serverErrorResponse(w, r, err)
+				return
+			}
+			if !enabled {
+				a.errorResponseJSON(w, r, http.StatusForbidden, "enable two-factor authentication to make changes with this account")
+				return
+			}
+		}
    next.ServeHTTP(w, r)
  }
- return a.requireActivatedUser(fn)  
+	// The mark has to be set before requireAuthenticatedUser looks for it
+	checked := a.requireActivatedUser(fn)
+	return func(w http.ResponseWriter, r *http.Request) {
+		checked.ServeHTTP(w, a.contextSetPermissionRoute(r))
+	}
 }
 
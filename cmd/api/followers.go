@@ -0,0 +1,125 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/luigiacunaUB/cmps4191-test-3/internal/data"
+)
+
+// ------------------------------------------------------------------------------------------------------------------------------------
+func (a *applicationDependencies) FollowReadingListHandler(w http.ResponseWriter, r *http.Request) {
+	// Any list the user can see can be followed, except their own
+	list, _, ok := a.readingListForUser(w, r)
+	if !ok {
+		return
+	}
+	user := a.contextGetUser(r)
+	if list.IsOwner(user.ID) {
+		a.errorResponseJSON(w, r, http.StatusUnprocessableEntity, "you can't follow your own reading list")
+		return
+	}
+
+	err := a.ReadingListModel.Follow(list.ID, user.ID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = a.writeJSON(w, http.StatusOK, envelope{
+		"message": fmt.Sprintf("You are now following reading list %d", list.ID),
+	}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// ------------------------------------------------------------------------------------------------------------------------------------
+func (a *applicationDependencies) UnfollowReadingListHandler(w http.ResponseWriter, r *http.Request) {
+	// Lists that have since been made private can still be unfollowed, so only the id is needed
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	err = a.ReadingListModel.Unfollow(id, a.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = a.writeJSON(w, http.StatusOK, envelope{
+		"message": fmt.Sprintf("You are no longer following reading list %d", id),
+	}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// ------------------------------------------------------------------------------------------------------------------------------------
+func (a *applicationDependencies) ListFollowedReadingListsHandler(w http.ResponseWriter, r *http.Request) {
+	readingLists, err := a.ReadingListModel.GetFollowedReadingLists(a.contextGetUser(r).ID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+	if !a.expandReadingLists(w, r, readingLists) {
+		return
+	}
+
+	err = a.writeJSON(w, http.StatusOK, envelope{"reading_lists": readingLists}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// notifyListFollowers emails the followers of the list about newly added books in the background, the user
+// who added them is not notified
+func (a *applicationDependencies) notifyListFollowers(list *data.ReadingList, bookIDs []int64, addedBy int64) {
+	if len(bookIDs) == 0 {
+		return
+	}
+
+	a.background(func() {
+		followers, err := a.ReadingListModel.GetFollowersToNotify(list.ID, addedBy)
+		if err != nil {
+			a.logger.Error(err.Error())
+			return
+		}
+		if len(followers) == 0 {
+			return
+		}
+
+		books, err := a.BookModel.GetBooksByIDs(bookIDs)
+		if err != nil {
+			a.logger.Error(err.Error())
+			return
+		}
+		var titles []string
+		for _, id := range bookIDs {
+			if book, ok := books[id]; ok {
+				titles = append(titles, book.Title)
+			}
+		}
+
+		for _, follower := range followers {
+			data := map[string]any{
+				"username":   follower.Username,
+				"listID":     list.ID,
+				"listName":   list.ReadListName,
+				"bookTitles": titles,
+			}
+			err = a.mailer.Send(follower.Email, "list_book_added.tmpl", data)
+			if err != nil {
+				a.logger.Error(err.Error())
+			}
+		}
+	})
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/luigiacunaUB/cmps4191-test-3/internal/data"
+	"github.com/luigiacunaUB/cmps4191-test-3/internal/validator"
+)
+
+// ------------------------------------------------------------------------------------------------------------------------------------
+func (a *applicationDependencies) CreateReadingGoalHandler(w http.ResponseWriter, r *http.Request) {
+	var incomingData struct {
+		Year   int `json:"year"`
+		Target int `json:"target"`
+	}
+	err := a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	// Goals default to the current year
+	goal := &data.ReadingGoal{
+		UserID: a.contextGetUser(r).ID,
+		Year:   incomingData.Year,
+		Target: incomingData.Target,
+	}
+	if goal.Year == 0 {
+		goal.Year = time.Now().Year()
+	}
+
+	v := validator.New()
+	data.ValidateReadingGoal(v, goal)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = a.ReadingGoalModel.Insert(goal)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateGoal):
+			v.AddError("year", "a goal for this year already exists")
+			a.failedValidationResponse(w, r, v.Errors)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/api/v1/me/goals/%d", goal.ID))
+
+	err = a.writeJSON(w, http.StatusCreated, envelope{"goal": goal}, headers)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// ------------------------------------------------------------------------------------------------------------------------------------
+func (a *applicationDependencies) ListReadingGoalsHandler(w http.ResponseWriter, r *http.Request) {
+	goals, err := a.ReadingGoalModel.GetAllForUser(a.contextGetUser(r).ID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = a.writeJSON(w, http.StatusOK, envelope{"goals": goals}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// ------------------------------------------------------------------------------------------------------------------------------------
+func (a *applicationDependencies) GetReadingGoalHandler(w http.ResponseWriter, r *http.Request) {
+	goal, ok := a.readingGoalForUser(w, r)
+	if !ok {
+		return
+	}
+
+	err := a.writeJSON(w, http.StatusOK, envelope{"goal": goal}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// ------------------------------------------------------------------------------------------------------------------------------------
+func (a *applicationDependencies) UpdateReadingGoalHandler(w http.ResponseWriter, r *http.Request) {
+	goal, ok := a.readingGoalForUser(w, r)
+	if !ok {
+		return
+	}
+
+	// Only the target can change, the year a goal is for is fixed
+	var incomingData struct {
+		Target *int `json:"target"`
+	}
+	err := a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+	if incomingData.Target != nil {
+		goal.Target = *incomingData.Target
+	}
+
+	v := validator.New()
+	data.ValidateReadingGoal(v, goal)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = a.ReadingGoalModel.Update(goal)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			a.editConflictResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = a.writeJSON(w, http.StatusOK, envelope{"goal": goal}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// ------------------------------------------------------------------------------------------------------------------------------------
+func (a *applicationDependencies) DeleteReadingGoalHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	err = a.ReadingGoalModel.Delete(id, a.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = a.writeJSON(w, http.StatusOK, envelope{"message": "goal successfully deleted"}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// ------------------------------------------------------------------------------------------------------------------------------------
+func (a *applicationDependencies) ReadingStatsHandler(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+
+	v := validator.New()
+	year := a.getSingleIntegerParameter(r.URL.Query(), "year", now.Year(), v)
+	v.Check(year >= 1900 && year <= now.Year()+1, "year", "must be a valid year")
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := a.contextGetUser(r)
+	stats, err := a.ReadingStatsModel.GetStats(user.ID, year, now)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// The goal for the year is included when the user has set one
+	stats.Goal, err = a.ReadingGoalModel.GetForYear(user.ID, year)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = a.writeJSON(w, http.StatusOK, envelope{"stats": stats}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// readingGoalForUser loads the goal named by the id parameter, goals belonging to other users are not found
+func (a *applicationDependencies) readingGoalForUser(w http.ResponseWriter, r *http.Request) (*data.ReadingGoal, bool) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	goal, err := a.ReadingGoalModel.Get(id, a.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	return goal, true
+}
@@ -0,0 +1,454 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/luigiacunaUB/cmps4191-test-3/internal/data"
+	"github.com/luigiacunaUB/cmps4191-test-3/internal/goodreads"
+	"github.com/luigiacunaUB/cmps4191-test-3/internal/markdown"
+	"github.com/luigiacunaUB/cmps4191-test-3/internal/validator"
+)
+
+// maxImportBytes caps the size of an uploaded Goodreads export
+const maxImportBytes = 10 << 20
+
+// importIssue describes a row of the file that could not be imported, or only partly
+type importIssue struct {
+	Line   int    `json:"line"`
+	Title  string `json:"title"`
+	Author string `json:"author,omitempty"`
+	ISBN   string `json:"isbn,omitempty"`
+	Reason string `json:"reason"`
+}
+
+type importReport struct {
+	Rows            int           `json:"rows"`
+	Matched         int           `json:"matched"`
+	BooksCreated    int           `json:"books_created"`
+	ListsCreated    []string      `json:"lists_created"`
+	EntriesAdded    int           `json:"entries_added"`
+	ReviewsImported int           `json:"reviews_imported"`
+	Unmatched       []importIssue `json:"unmatched"`
+	Warnings        []importIssue `json:"warnings"`
+}
+
+// goodreadsImport holds the state of one import while its rows are worked through
+type goodreadsImport struct {
+	a             *applicationDependencies
+	r             *http.Request
+	user          *data.User
+	createMissing bool
+	report        importReport
+	// shelf name to reading list id, and the books going on each list in file order. Shelves whose
+	// name the content filter rejects are skipped.
+	lists     map[string]int64
+	skipped   map[string]bool
+	listOrder []int64
+	listBooks map[int64][]int64
+	// the row each book came from, a book listed twice keeps its last row
+	bookRows map[int64]goodreads.Row
+}
+
+// ------------------------------------------------------------------------------------------------------------------------------------
+func (a *applicationDependencies) ImportGoodreadsHandler(w http.ResponseWriter, r *http.Request) {
+	user := a.contextGetUser(r)
+
+	// The import writes lists and reviews, so the route needs books:write. Books that can't be matched are
+	// only created when asked for.
+	v := validator.New()
+	createMissing := false
+	if value := r.URL.Query().Get("create_missing"); value != "" {
+		var err error
+		createMissing, err = strconv.ParseBool(value)
+		v.Check(err == nil, "create_missing", "must be true or false")
+	}
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// The export can be uploaded as a form file named "file" or sent as the request body
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportBytes)
+	var file io.Reader = r.Body
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		upload, _, err := r.FormFile("file")
+		if err != nil {
+			a.badRequestResponse(w, r, err)
+			return
+		}
+		defer upload.Close()
+		file = upload
+	}
+
+	rows, err := goodreads.Read(file)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	imp := &goodreadsImport{
+		a:             a,
+		r:             r,
+		user:          user,
+		createMissing: createMissing,
+		report:        importReport{Rows: len(rows), ListsCreated: []string{}, Unmatched: []importIssue{}, Warnings: []importIssue{}},
+		lists:         make(map[string]int64),
+		skipped:       make(map[string]bool),
+		listBooks:     make(map[int64][]int64),
+		bookRows:      make(map[int64]goodreads.Row),
+	}
+	for _, row := range rows {
+		err = imp.addRow(row)
+		if err != nil {
+			imp.failed(w, err)
+			return
+		}
+	}
+	err = imp.fillLists()
+	if err != nil {
+		imp.failed(w, err)
+		return
+	}
+
+	err = a.writeJSON(w, http.StatusOK, envelope{"report": imp.report}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// failed reports an import that stopped partway along with what it got done. Every step of an import finds
+// what an earlier run already created, so sending the same file again picks up where this one stopped.
+func (imp *goodreadsImport) failed(w http.ResponseWriter, err error) {
+	imp.a.logError(imp.r, err)
+	imp.a.errorResponseJSON(w, imp.r, http.StatusInternalServerError, envelope{
+		"message": "the import stopped partway because of a server problem, send the same file again to finish it",
+		"report":  imp.report,
+	})
+}
+
+// addRow matches the row to a book, notes which lists it goes on and imports its rating
+func (imp *goodreadsImport) addRow(row goodreads.Row) error {
+	bookID, err := imp.findBook(row)
+	if err != nil {
+		return err
+	}
+	if bookID == 0 {
+		return nil
+	}
+	imp.report.Matched++
+	imp.bookRows[bookID] = row
+
+	for _, shelf := range row.AllShelves() {
+		listID, err := imp.listFor(row, shelf)
+		if err != nil {
+			return err
+		}
+		if listID == 0 {
+			continue
+		}
+		imp.listBooks[listID] = append(imp.listBooks[listID], bookID)
+	}
+
+	if row.MyRating > 0 {
+		return imp.importReview(row, bookID)
+	}
+	return nil
+}
+
+// findBook returns the id of the row's book, creating it when that was asked for. Rows without a book are added
+// to the report and 0 is returned.
+func (imp *goodreadsImport) findBook(row goodreads.Row) (int64, error) {
+	titles := []string{row.Title}
+	if short := row.ShortTitle(); short != row.Title {
+		titles = append(titles, short)
+	}
+	bookID, err := imp.a.BookModel.FindBookID(row.ISBNs(), titles, row.Author)
+	if err == nil {
+		return bookID, nil
+	}
+	if !errors.Is(err, data.ErrRecordNotFound) {
+		return 0, err
+	}
+
+	issue := importIssue{Line: row.Line, Title: row.Title, Author: row.Author, Reason: "no matching book"}
+	if isbns := row.ISBNs(); len(isbns) > 0 {
+		issue.ISBN = isbns[0]
+	}
+	if !imp.createMissing {
+		imp.report.Unmatched = append(imp.report.Unmatched, issue)
+		return 0, nil
+	}
+
+	// Goodreads doesn't export a genre or description, so new books get placeholders
+	book := data.Book{
+		Title:         row.ShortTitle(),
+		Authors:       row.Authors(),
+		ISBN:          issue.ISBN,
+		Genre:         "Unknown",
+		Description:   "Imported from Goodreads",
+		AverageRating: min(max(row.AverageRating, 1), 5),
+	}
+	if row.YearPublished > 0 {
+		book.PublicationDate = time.Date(row.YearPublished, time.January, 1, 0, 0, 0, 0, time.UTC)
+	}
+	v := validator.New()
+	data.ValidateBook(v, imp.a.BookModel, &book)
+	if !v.IsEmpty() {
+		var problems []string
+		for field, message := range v.Errors {
+			problems = append(problems, field+": "+message)
+		}
+		sort.Strings(problems)
+		issue.Reason = "no matching book and it could not be created (" + strings.Join(problems, ", ") + ")"
+		imp.report.Unmatched = append(imp.report.Unmatched, issue)
+		return 0, nil
+	}
+
+	bookID, err = imp.a.BookModel.AddBookToDatabase(book)
+	if err != nil {
+		return 0, err
+	}
+	imp.report.BooksCreated++
+	return bookID, nil
+}
+
+// listFor returns the user's reading list for a shelf, creating a private list when they don't have one. The
+// shelf name goes through the content filter like any other list name. A shelf the filter rejects is reported
+// once, with the first row on it, and 0 is returned.
+func (imp *goodreadsImport) listFor(row goodreads.Row, shelf string) (int64, error) {
+	if imp.skipped[shelf] {
+		return 0, nil
+	}
+	v := validator.New()
+	name, flagReasons := imp.a.filterContent(v, "Title", shelf)
+	if !v.IsEmpty() {
+		imp.skipped[shelf] = true
+		imp.warn(row, fmt.Sprintf("the shelf %q was not imported, its name %s", shelf, v.Errors["Title"]))
+		return 0, nil
+	}
+	name = truncate(name, 25)
+	if id, ok := imp.lists[name]; ok {
+		return id, nil
+	}
+
+	id, err := imp.a.ReadingListModel.GetOwnedListID(imp.user.ID, name)
+	if errors.Is(err, data.ErrRecordNotFound) {
+		var list data.ReadingList
+		list, _, err = imp.a.ReadingListModel.AddReadingListToDatabase(data.ReadingList{
+			ReadListName: name,
+			Description:  "Imported from Goodreads",
+			CreatedBy:    imp.user.ID,
+			Visibility:   data.VisibilityPrivate,
+		})
+		id = list.ID
+		if err == nil {
+			imp.report.ListsCreated = append(imp.report.ListsCreated, name)
+			imp.a.flagContent(imp.r, data.ContentTypeReadingList, id, flagReasons)
+		}
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	imp.lists[name] = id
+	imp.listOrder = append(imp.listOrder, id)
+	return id, nil
+}
+
+// importReview turns the row's rating, and review if it has one, into a review. Books the user already reviewed
+// are left alone.
+func (imp *goodreadsImport) importReview(row goodreads.Row, bookID int64) error {
+	if imp.a.ReviewModel.CheckIfReviewExistForUser(bookID, imp.user.ID) {
+		return nil
+	}
+
+	review := data.Review{
+		BookID: bookID,
+		UserID: imp.user.ID,
+		Rating: int64(row.MyRating),
+	}
+
+	// Goodreads reviews are HTML with <br/> line breaks
+	text := strings.NewReplacer("<br />", "\n", "<br/>", "\n", "<br>", "\n").Replace(row.MyReview)
+	var flagReasons []string
+	if text != "" {
+		v := validator.New()
+		text, flagReasons = imp.a.filterContent(v, "review", text)
+		maxLength := imp.a.ReviewModel.MaxLength
+		if maxLength <= 0 {
+			maxLength = data.DefaultReviewMaxLength
+		}
+		switch {
+		case !v.IsEmpty():
+			imp.warn(row, "the review text was not imported, "+v.Errors["review"])
+			text, flagReasons = "", nil
+		case len(text) > maxLength:
+			imp.warn(row, fmt.Sprintf("the review text was not imported, it is more than %d bytes long", maxLength))
+			text, flagReasons = "", nil
+		}
+	}
+
+	var err error
+	review.Review = text
+	review.ReviewHTML, err = markdown.Render(text)
+	if err != nil {
+		return err
+	}
+
+	created, err := imp.a.ReviewModel.AddBookReview(review)
+	if err != nil {
+		return err
+	}
+	imp.a.flagContent(imp.r, data.ContentTypeReview, created.ID, flagReasons)
+	imp.report.ReviewsImported++
+	return nil
+}
+
+// fillLists adds the matched books to their lists and sets the reading state of the new entries from the
+// Goodreads exclusive shelf
+func (imp *goodreadsImport) fillLists() error {
+	now := time.Now()
+	for _, listID := range imp.listOrder {
+		results, err := imp.a.ReadingListModel.AddBooksToReadingList(listID, imp.listBooks[listID], 0, false)
+		if err != nil {
+			return err
+		}
+
+		for _, result := range results {
+			switch result.Result {
+			case data.BookAdded:
+				imp.report.EntriesAdded++
+			case data.BookAlreadyPresent:
+				// An earlier run may have stopped before the reading state was set, the state of an entry the
+				// user has since worked on is left alone
+				existing, err := imp.a.ReadingListModel.GetEntry(listID, result.BookID)
+				if err != nil {
+					return err
+				}
+				if existing.Status != data.EntryWantToRead || existing.StartedAt != nil || existing.FinishedAt != nil {
+					continue
+				}
+			default:
+				continue
+			}
+
+			row := imp.bookRows[result.BookID]
+			entry := data.ReadingListEntry{BookID: result.BookID}
+			switch row.ExclusiveShelf {
+			case goodreads.ShelfRead:
+				entry.Status = data.EntryFinished
+				entry.FinishedAt = firstDate(row.DateRead, row.DateAdded, &now)
+				entry.StartedAt = entry.FinishedAt
+				if row.DateAdded != nil && row.DateAdded.Before(*entry.FinishedAt) {
+					entry.StartedAt = row.DateAdded
+				}
+			case goodreads.ShelfCurrentlyReading:
+				entry.Status = data.EntryReading
+				entry.StartedAt = firstDate(row.DateAdded, &now)
+			default:
+				continue
+			}
+
+			v := validator.New()
+			data.ValidateReadingListEntry(v, &entry)
+			if !v.IsEmpty() {
+				imp.warn(row, "the reading status was not imported, the dates are not valid")
+				continue
+			}
+			_, err = imp.a.ReadingListModel.UpdateEntry(listID, entry)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (imp *goodreadsImport) warn(row goodreads.Row, reason string) {
+	imp.report.Warnings = append(imp.report.Warnings, importIssue{Line: row.Line, Title: row.Title, Author: row.Author, Reason: reason})
+}
+
+// ------------------------------------------------------------------------------------------------------------------------------------
+func (a *applicationDependencies) ExportGoodreadsHandler(w http.ResponseWriter, r *http.Request) {
+	library, err := a.ReadingListModel.GetLibrary(a.contextGetUser(r).ID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	rows := make([]goodreads.Row, 0, len(library))
+	for _, book := range library {
+		row := goodreads.Row{
+			BookID:        strconv.FormatInt(book.ID, 10),
+			Title:         book.Title,
+			MyRating:      book.Rating,
+			AverageRating: book.AverageRating,
+			YearPublished: book.PublicationDate.Year(),
+			DateRead:      book.FinishedAt,
+			Shelves:       book.Lists,
+			MyReview:      book.Review,
+		}
+		if len(book.Authors) > 0 {
+			row.Author = book.Authors[0]
+			row.AdditionalAuthors = book.Authors[1:]
+		}
+		if len(book.ISBN) == 13 {
+			row.ISBN13 = book.ISBN
+		} else {
+			row.ISBN = book.ISBN
+		}
+		switch book.Status {
+		case data.EntryFinished, "":
+			// books that were only reviewed have been read
+			row.ExclusiveShelf = goodreads.ShelfRead
+		case data.EntryReading:
+			row.ExclusiveShelf = goodreads.ShelfCurrentlyReading
+		default:
+			row.ExclusiveShelf = goodreads.ShelfToRead
+		}
+		rows = append(rows, row)
+	}
+
+	// Build the whole file first so a failure can still be reported as an error
+	var file bytes.Buffer
+	err = goodreads.Write(&file, rows)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="goodreads_library_export.csv"`)
+	w.WriteHeader(http.StatusOK)
+	w.Write(file.Bytes())
+}
+
+// firstDate returns the first date that is set
+func firstDate(dates ...*time.Time) *time.Time {
+	for _, date := range dates {
+		if date != nil {
+			return date
+		}
+	}
+	return nil
+}
+
+// truncate shortens s to at most n bytes without cutting a character in half
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
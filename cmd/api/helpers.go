@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -90,6 +91,16 @@ func (a *applicationDependencies) readIDParam(r *http.Request) (int64, error) {
 	return id, nil
 }
 
+// readNamedIDParam reads a positive id from a named route parameter such as :book_id
+func (a *applicationDependencies) readNamedIDParam(r *http.Request, name string) (int64, error) {
+	params := httprouter.ParamsFromContext(r.Context())
+	id, err := strconv.ParseInt(params.ByName(name), 10, 64)
+	if err != nil || id < 1 {
+		return 0, fmt.Errorf("invalid %s parameter", name)
+	}
+	return id, nil
+}
+
 func (a *applicationDependencies) getSingleQueryParameter(queryParameters url.Values, key string, defaultValue string) string {
 	result := queryParameters.Get(key)
 	if result == "" {
@@ -131,3 +142,12 @@ func (a *applicationDependencies) background(fn func()) {
 		fn()
 	}()
 }
+
+// clientIP returns the address the request came from without the port
+func clientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/luigiacunaUB/cmps4191-test-3/internal/data"
+	"github.com/luigiacunaUB/cmps4191-test-3/internal/jwtauth"
+)
+
+// the values of the -auth-mode flag
+const (
+	authModeOpaque = "opaque"
+	authModeJWT    = "jwt"
+)
+
+// newJWTKeySet builds the signing keys from the startup flags, there are none in opaque mode
+func newJWTKeySet(settings serverConfig) (*jwtauth.KeySet, error) {
+	switch settings.auth.mode {
+	case authModeOpaque:
+		return nil, nil
+	case authModeJWT:
+		return jwtauth.ParseKeySet(settings.auth.jwtKeys, settings.auth.jwtIssuer)
+	default:
+		return nil, fmt.Errorf("unknown auth mode %q, must be %s or %s", settings.auth.mode, authModeOpaque, authModeJWT)
+	}
+}
+
+// tokenDenylist is the in-memory copy of revoked_tokens that JWTs are checked against, keyed by the
+// hex encoded hash of the token id
+type tokenDenylist struct {
+	mu     sync.RWMutex
+	hashes map[string]time.Time
+}
+
+func (d *tokenDenylist) contains(hash string) bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	expiry, found := d.hashes[hash]
+	return found && time.Now().Before(expiry)
+}
+
+func (d *tokenDenylist) replace(hashes map[string]time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.hashes = hashes
+}
+
+// reloadDenylist reads the revoked tokens from the database
+func (a *applicationDependencies) reloadDenylist() error {
+	hashes, err := a.TokenModel.GetRevokedTokens()
+	if err != nil {
+		return err
+	}
+	a.denylist.replace(hashes)
+	return nil
+}
+
+// startDenylistRefresh loads the denylist and keeps reloading it, so tokens revoked through another
+// instance of the API are refused here within the refresh interval
+func (a *applicationDependencies) startDenylistRefresh() error {
+	err := a.reloadDenylist()
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		ticker := time.NewTicker(a.config.auth.denylistRefresh)
+		defer ticker.Stop()
+		for range ticker.C {
+			err := a.reloadDenylist()
+			if err != nil {
+				a.logger.Error(err.Error())
+			}
+		}
+	}()
+	return nil
+}
+
+// sessionsRevoked is called after tokens were deleted, in jwt mode it reloads the denylist right away so
+// this instance stops accepting them without waiting for the next refresh
+func (a *applicationDependencies) sessionsRevoked() {
+	if a.jwtKeys == nil {
+		return
+	}
+	err := a.reloadDenylist()
+	if err != nil {
+		a.logger.Error(err.Error())
+	}
+}
+
+// issueAccessToken turns a freshly stored access token into a signed JWT in jwt mode. The JWT's id is the
+// hash of the stored token, the form the denylist holds, so the session it belongs to can still be revoked
+// without the JWT carrying a secret. In opaque mode it does nothing.
+func (a *applicationDependencies) issueAccessToken(user *data.User, token *data.Token) error {
+	if a.jwtKeys == nil {
+		return nil
+	}
+
+	permissions, err := a.PermissionModel.GetAllForUser(user.ID)
+	if err != nil {
+		return err
+	}
+	if permissions == nil {
+		permissions = data.Permissions{}
+	}
+
+	signed, err := a.jwtKeys.Sign(jwtauth.Claims{
+		Username:    user.Username,
+		Activated:   user.Activated,
+		Permissions: permissions,
+		SessionID:   token.FamilyID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   strconv.FormatInt(user.ID, 10),
+			ID:        data.HashTokenPlaintext(token.Plaintext),
+			IssuedAt:  jwt.NewNumericDate(token.CreatedAt),
+			ExpiresAt: jwt.NewNumericDate(token.Expiry),
+		},
+	})
+	if err != nil {
+		return err
+	}
+	token.Plaintext = signed
+	return nil
+}
+
+// authenticateJWT verifies a JWT access token without touching the database and adds its user,
+// session and permissions to the request context. The user only has what the claims hold, see currentUser.
+func (a *applicationDependencies) authenticateJWT(r *http.Request, tokenString string) (*http.Request, bool) {
+	claims, err := a.jwtKeys.Verify(tokenString)
+	if err != nil {
+		return r, false
+	}
+	if a.denylist.contains(claims.ID) {
+		return r, false
+	}
+
+	userID, _ := claims.UserID()
+	user := &data.User{
+		ID:        userID,
+		Username:  claims.Username,
+		Activated: claims.Activated,
+	}
+
+	r = a.contextSetClaimsUser(r, user)
+	r = a.contextSetSessionID(r, claims.SessionID)
+	r = a.contextSetPermissions(r, claims.Permissions)
+	return r, true
+}
+
+// currentUser returns the request's user with every field filled in. Opaque tokens and API keys already read
+// the whole user, one built from JWT claims is loaded from the database.
+func (a *applicationDependencies) currentUser(r *http.Request) (*data.User, error) {
+	user := a.contextGetUser(r)
+	if !a.contextHasClaimsUser(r) {
+		return user, nil
+	}
+	return a.UserModel.Get(user.ID)
+}
+
+// userPermissions returns the permissions carried by the request's JWT, or looks them up for opaque tokens
+func (a *applicationDependencies) userPermissions(r *http.Request) (data.Permissions, error) {
+	if permissions, ok := a.contextGetPermissions(r); ok {
+		return permissions, nil
+	}
+	return a.PermissionModel.GetAllForUser(a.contextGetUser(r).ID)
+}
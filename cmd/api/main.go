@@ -13,12 +13,16 @@ import (
 	"flag"
 	"log/slog"
 	"os"
+	"strings"
 	"sync"
 	"time"
 
 	_ "github.com/lib/pq"
+	"github.com/luigiacunaUB/cmps4191-test-3/internal/content"
 	"github.com/luigiacunaUB/cmps4191-test-3/internal/data"
+	"github.com/luigiacunaUB/cmps4191-test-3/internal/jwtauth"
 	"github.com/luigiacunaUB/cmps4191-test-3/internal/mailer"
+	"github.com/luigiacunaUB/cmps4191-test-3/internal/oidc"
 )
 
 const appVersion = "1.0.0"
@@ -41,19 +45,62 @@ type serverConfig struct {
 		password string
 		sender   string
 	}
+	reviews struct {
+		maxLength int
+	}
+	ranking struct {
+		priorMean   float64
+		priorWeight float64
+	}
+	tokens struct {
+		accessTTL  time.Duration
+		refreshTTL time.Duration
+	}
+	auth struct {
+		mode            string
+		jwtKeys         string
+		jwtIssuer       string
+		denylistRefresh time.Duration
+	}
+	oidc struct {
+		issuer       string
+		clientID     string
+		clientSecret string
+		redirectURL  string
+		scopes       string
+	}
+	content struct {
+		bannedWords  string
+		bannedAction string
+		maxLinks     int
+		linksAction  string
+		maxRepeat    int
+		repeatAction string
+	}
 }
 
 type applicationDependencies struct {
-	config           serverConfig
-	logger           *slog.Logger
-	BookModel        data.BookModel
-	UserModel        data.UserModel
-	TokenModel       data.TokenModel
-	PermissionModel  data.PermissionModel
-	ReviewModel      data.ReviewModel
-	ReadingListModel data.ReadingListModel
-	mailer           mailer.Mailer
-	wg               sync.WaitGroup
+	config            serverConfig
+	logger            *slog.Logger
+	BookModel         data.BookModel
+	UserModel         data.UserModel
+	TokenModel        data.TokenModel
+	PermissionModel   data.PermissionModel
+	ReviewModel       data.ReviewModel
+	ReadingListModel  data.ReadingListModel
+	ContentFlagModel  data.ContentFlagModel
+	ReadingGoalModel  data.ReadingGoalModel
+	ReadingStatsModel data.ReadingStatsModel
+	APIKeyModel       data.APIKeyModel
+	IdentityModel     data.IdentityModel
+	TwoFactorModel    data.TwoFactorModel
+	SettingsModel     data.SettingsModel
+	contentFilter     *content.Pipeline
+	jwtKeys           *jwtauth.KeySet
+	denylist          *tokenDenylist
+	oidc              *oidc.Provider
+	mailer            mailer.Mailer
+	wg                sync.WaitGroup
 }
 
 func main() {
@@ -73,11 +120,54 @@ func main() {
 	flag.StringVar(&settings.smtp.username, "smtp-username", "", "SMTP username")
 	flag.StringVar(&settings.smtp.username, "smtp-password", "", "SMTP password")
 	flag.StringVar(&settings.smtp.sender, "smtp-sender", "Book Club <no-reply@bookclub.net>", "SMTP sender")
+	flag.IntVar(&settings.reviews.maxLength, "review-max-length", data.DefaultReviewMaxLength, "Maximum review length in bytes")
+	//prior for the bayesian top rated leaderboards, a mean of 0 uses the mean of all reviews in the period
+	flag.Float64Var(&settings.ranking.priorMean, "ranking-prior-mean", 0, "Prior mean rating for top rated books (0 = mean of all reviews)")
+	flag.Float64Var(&settings.ranking.priorWeight, "ranking-prior-weight", 10, "Prior weight, in reviews, for top rated books")
+	//access tokens are short-lived, the refresh token is exchanged for a new pair and rotates on every use
+	flag.DurationVar(&settings.tokens.accessTTL, "access-token-ttl", 15*time.Minute, "Lifetime of an access token")
+	flag.DurationVar(&settings.tokens.refreshTTL, "refresh-token-ttl", 30*24*time.Hour, "Lifetime of a refresh token")
+	//in jwt mode access tokens are signed JWTs checked without the database, revoked ones are refused through a denylist
+	flag.StringVar(&settings.auth.mode, "auth-mode", authModeOpaque, "Access token type (opaque|jwt)")
+	flag.StringVar(&settings.auth.jwtKeys, "jwt-keys", "", "Comma separated kid:secret JWT keys, the first one signs new tokens")
+	flag.StringVar(&settings.auth.jwtIssuer, "jwt-issuer", "bookclub", "Issuer claim of the JWTs")
+	flag.DurationVar(&settings.auth.denylistRefresh, "jwt-denylist-refresh", 15*time.Second, "How often the revoked token denylist is reloaded")
+	//login through an OpenID Connect provider is turned on by setting an issuer
+	flag.StringVar(&settings.oidc.issuer, "oidc-issuer", "", "OpenID Connect issuer URL (empty = disabled)")
+	flag.StringVar(&settings.oidc.clientID, "oidc-client-id", "", "OpenID Connect client id")
+	flag.StringVar(&settings.oidc.clientSecret, "oidc-client-secret", "", "OpenID Connect client secret")
+	flag.StringVar(&settings.oidc.redirectURL, "oidc-redirect-url", "", "OpenID Connect redirect URL, pointing at /v1/oidc/callback")
+	flag.StringVar(&settings.oidc.scopes, "oidc-scopes", "email profile", "Space separated OpenID Connect scopes requested besides openid")
+	//content filters for user submitted text, every action is one of off|mask|flag|reject
+	flag.StringVar(&settings.content.bannedWords, "content-banned-words", "", "Comma separated list of banned words")
+	flag.StringVar(&settings.content.bannedAction, "content-banned-action", "mask", "Action for banned words (off|mask|flag|reject)")
+	flag.IntVar(&settings.content.maxLinks, "content-max-links", 2, "Maximum number of links before text counts as spam")
+	flag.StringVar(&settings.content.linksAction, "content-links-action", "flag", "Action for link spam (off|mask|flag|reject)")
+	flag.IntVar(&settings.content.maxRepeat, "content-max-repeat", 8, "Maximum number of times a character may repeat in a row")
+	flag.StringVar(&settings.content.repeatAction, "content-repeat-action", "flag", "Action for repeated characters (off|mask|flag|reject)")
 
 	flag.Parse()
 
 	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
 
+	contentFilter, err := newContentPipeline(settings)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	jwtKeys, err := newJWTKeySet(settings)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	oidcProvider, err := newOIDCProvider(settings)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
 	db, err := openDB(settings)
 	if err != nil {
 		logger.Error(err.Error())
@@ -87,15 +177,34 @@ func main() {
 	logger.Info("database connection pool established")
 
 	appInstance := &applicationDependencies{
-		config:           settings,
-		logger:           logger,
-		BookModel:        data.BookModel{DB: db},
-		UserModel:        data.UserModel{DB: db},
-		TokenModel:       data.TokenModel{DB: db},
-		PermissionModel:  data.PermissionModel{DB: db},
-		ReviewModel:      data.ReviewModel{DB: db},
-		ReadingListModel: data.ReadingListModel{DB: db},
-		mailer:           mailer.New(settings.smtp.host, settings.smtp.port, settings.smtp.username, settings.smtp.password, settings.smtp.sender),
+		config:            settings,
+		logger:            logger,
+		BookModel:         data.BookModel{DB: db},
+		UserModel:         data.UserModel{DB: db},
+		TokenModel:        data.TokenModel{DB: db},
+		PermissionModel:   data.PermissionModel{DB: db},
+		ReviewModel:       data.ReviewModel{DB: db, MaxLength: settings.reviews.maxLength},
+		ReadingListModel:  data.ReadingListModel{DB: db},
+		ContentFlagModel:  data.ContentFlagModel{DB: db},
+		ReadingGoalModel:  data.ReadingGoalModel{DB: db},
+		ReadingStatsModel: data.ReadingStatsModel{DB: db},
+		APIKeyModel:       data.APIKeyModel{DB: db},
+		IdentityModel:     data.IdentityModel{DB: db},
+		TwoFactorModel:    data.TwoFactorModel{DB: db},
+		SettingsModel:     data.SettingsModel{DB: db},
+		contentFilter:     contentFilter,
+		jwtKeys:           jwtKeys,
+		denylist:          &tokenDenylist{},
+		oidc:              oidcProvider,
+		mailer:            mailer.New(settings.smtp.host, settings.smtp.port, settings.smtp.username, settings.smtp.password, settings.smtp.sender),
+	}
+
+	if settings.auth.mode == authModeJWT {
+		err = appInstance.startDenylistRefresh()
+		if err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
 	}
 
 	err = appInstance.serve()
@@ -122,3 +231,31 @@ func openDB(settings serverConfig) (*sql.DB, error) {
 
 	return db, nil
 }
+
+// newContentPipeline builds the content filters from the startup flags
+func newContentPipeline(settings serverConfig) (*content.Pipeline, error) {
+	bannedAction, err := content.ParseAction(settings.content.bannedAction)
+	if err != nil {
+		return nil, err
+	}
+	linksAction, err := content.ParseAction(settings.content.linksAction)
+	if err != nil {
+		return nil, err
+	}
+	repeatAction, err := content.ParseAction(settings.content.repeatAction)
+	if err != nil {
+		return nil, err
+	}
+
+	var bannedWords []string
+	if settings.content.bannedWords != "" {
+		bannedWords = strings.Split(settings.content.bannedWords, ",")
+	}
+
+	// banned words run last so their asterisks are not mistaken for repeated characters
+	return content.NewPipeline(
+		content.NewRepeatedCharacters(settings.content.maxRepeat, repeatAction),
+		content.NewLinks(settings.content.maxLinks, linksAction),
+		content.NewBannedWords(bannedWords, bannedAction),
+	), nil
+}
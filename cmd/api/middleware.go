@@ -83,11 +83,27 @@ func (a *applicationDependencies) authenticate(next http.Handler) http.Handler {
 			return
 		}
 		headerParts := strings.Split(authorizationHeader, " ")
+		if len(headerParts) == 2 && headerParts[0] == "ApiKey" {
+			a.authenticateAPIKey(w, r, headerParts[1], next)
+			return
+		}
 		if len(headerParts) != 2 || headerParts[0] != "Bearer" {
 			a.invalidAuthenticationTokenResponse(w, r)
 			return
 		}
 		token := headerParts[1]
+
+		// In jwt mode the token is checked without touching the database
+		if a.jwtKeys != nil {
+			r, ok := a.authenticateJWT(r, token)
+			if !ok {
+				a.invalidAuthenticationTokenResponse(w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
 		v := validator.New()
 
 		data.ValidateTokenPlaintext(v, token)
@@ -96,7 +112,7 @@ func (a *applicationDependencies) authenticate(next http.Handler) http.Handler {
 			return
 		}
 
-		user, err := a.UserModel.GetForToken(data.ScopeAuthentication, token)
+		user, session, err := a.UserModel.GetForSession(token)
 		if err != nil {
 			switch {
 			case errors.Is(err, data.ErrRecordNotFound):
@@ -106,8 +122,14 @@ func (a *applicationDependencies) authenticate(next http.Handler) http.Handler {
 			}
 			return
 		}
+		// A failed last-used update shouldn't fail the request itself
+		err = a.TokenModel.TouchSession(session, clientIP(r))
+		if err != nil {
+			a.logger.Error(err.Error())
+		}
 		// Add the retrieved user info to the context
 		r = a.contextSetUser(r, user)
+		r = a.contextSetSessionID(r, session.ID)
 
 		// Call the next handler in the chain.
 		next.ServeHTTP(w, r)
@@ -123,6 +145,12 @@ func (a *applicationDependencies) requireAuthenticatedUser(next http.HandlerFunc
             a.authenticationRequiredResponse(w, r)
             return
        }
+		// An API key only reaches routes that require a permission the key was given,
+		// account and session routes have none and stay closed to it
+		if a.contextGetAPIKeyID(r) != 0 && !a.contextIsPermissionRoute(r) {
+			a.apiKeyNotAllowedResponse(w, r)
+			return
+		}
         next.ServeHTTP(w, r)
     })
 }
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/luigiacunaUB/cmps4191-test-3/internal/data"
+	"github.com/luigiacunaUB/cmps4191-test-3/internal/oidc"
+	"github.com/luigiacunaUB/cmps4191-test-3/internal/validator"
+)
+
+// oidcLoginTTL is how long the user has to finish logging in at the provider
+const oidcLoginTTL = 10 * time.Minute
+
+var (
+	errOIDCNoEmail         = errors.New("the identity provider did not share an email address")
+	errOIDCEmailUnverified = errors.New("an account with this email address already exists, log in with your password")
+	errOIDCInvalidProfile  = errors.New("the email address shared by the identity provider is not valid")
+)
+
+// newOIDCProvider builds the identity provider from the startup flags, there is none when no issuer is set
+func newOIDCProvider(settings serverConfig) (*oidc.Provider, error) {
+	if settings.oidc.issuer == "" {
+		return nil, nil
+	}
+	return oidc.New(oidc.Config{
+		IssuerURL:    settings.oidc.issuer,
+		ClientID:     settings.oidc.clientID,
+		ClientSecret: settings.oidc.clientSecret,
+		RedirectURL:  settings.oidc.redirectURL,
+		Scopes:       strings.Fields(settings.oidc.scopes),
+	})
+}
+
+// ------------------------------------------------------------------------------------------------------------------------------
+func (a *applicationDependencies) oidcLoginHandler(w http.ResponseWriter, r *http.Request) {
+	if a.oidc == nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	// The verifier and nonce stay on the server, the state sent along with the user finds them again
+	state, err := oidc.RandomString()
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+	nonce, err := oidc.RandomString()
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+	verifier, err := oidc.RandomString()
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	authorizationURL, err := a.oidc.AuthCodeURL(r.Context(), state, nonce, verifier)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = a.IdentityModel.InsertLoginState(state, verifier, nonce, oidcLoginTTL)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = a.writeJSON(w, http.StatusOK, envelope{"authorization_url": authorizationURL}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// ------------------------------------------------------------------------------------------------------------------------------
+func (a *applicationDependencies) oidcCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	if a.oidc == nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	queryParameters := r.URL.Query()
+	if providerError := queryParameters.Get("error"); providerError != "" {
+		a.errorResponseJSON(w, r, http.StatusUnauthorized, "the identity provider refused the login: "+providerError)
+		return
+	}
+
+	code := queryParameters.Get("code")
+	state := queryParameters.Get("state")
+	v := validator.New()
+	v.Check(code != "", "code", "must be provided")
+	v.Check(state != "", "state", "must be provided")
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	verifier, nonce, err := a.IdentityModel.ConsumeLoginState(state)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("state", "invalid or expired login, please start again")
+			a.failedValidationResponse(w, r, v.Errors)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	claims, err := a.oidc.Exchange(r.Context(), code, verifier, nonce)
+	if err != nil {
+		switch {
+		case errors.Is(err, oidc.ErrExchangeFailed), errors.Is(err, oidc.ErrInvalidIDToken):
+			a.logger.Warn("oidc login failed", "error", err.Error())
+			a.errorResponseJSON(w, r, http.StatusUnauthorized, "the login at the identity provider could not be verified")
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	user, err := a.userForIdentity(claims)
+	if err != nil {
+		switch {
+		case errors.Is(err, errOIDCNoEmail), errors.Is(err, errOIDCEmailUnverified), errors.Is(err, errOIDCInvalidProfile):
+			a.errorResponseJSON(w, r, http.StatusConflict, err.Error())
+		case errors.Is(err, data.ErrDuplicateEmail):
+			// Another login created the account at the same time, the next attempt finds it
+			a.errorResponseJSON(w, r, http.StatusConflict, "the account is being created, please log in again")
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// From here on it is an ordinary login, including the second factor
+	twoFactorEnabled, err := a.TwoFactorModel.IsEnabled(user.ID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+	if twoFactorEnabled {
+		a.writeTwoFactorChallenge(w, r, user)
+		return
+	}
+	token, refreshToken, err := a.TokenModel.NewSession(user.ID, a.config.tokens.accessTTL, a.config.tokens.refreshTTL, clientIP(r), truncate(r.UserAgent(), 512))
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+	err = a.issueAccessToken(user, token)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = a.writeJSON(w, http.StatusCreated, envelope{
+		"authentication_token": token,
+		"refresh_token":        refreshToken,
+		"user":                 user,
+	}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// userForIdentity returns the user linked to the provider account. On the first login the account is linked to
+// the user with the same verified email address, or a new activated user is created for it.
+func (a *applicationDependencies) userForIdentity(claims *oidc.Claims) (*data.User, error) {
+	issuer := a.oidc.Issuer()
+
+	userID, err := a.IdentityModel.GetUserID(issuer, claims.Subject, claims.Email)
+	if err == nil {
+		return a.UserModel.Get(userID)
+	}
+	if !errors.Is(err, data.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	if claims.Email == "" {
+		return nil, errOIDCNoEmail
+	}
+
+	user, err := a.UserModel.GetByEmail(claims.Email)
+	switch {
+	case err == nil:
+		// Only an address the provider has checked may take over an existing account
+		if !claims.EmailVerified {
+			return nil, errOIDCEmailUnverified
+		}
+		if !user.Activated {
+			user.Activated = true
+			err = a.UserModel.Update(user)
+			if err != nil {
+				return nil, err
+			}
+		}
+	case errors.Is(err, data.ErrRecordNotFound):
+		user, err = a.createUserForIdentity(claims)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+
+	err = a.IdentityModel.Link(user.ID, issuer, claims.Subject, claims.Email)
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// createUserForIdentity registers an activated user for a first login through the provider. The password is
+// random, a password reset gives the user one they can use without the provider.
+func (a *applicationDependencies) createUserForIdentity(claims *oidc.Claims) (*data.User, error) {
+	username := claims.PreferredUsername
+	if username == "" {
+		username = claims.Name
+	}
+	if username == "" {
+		username, _, _ = strings.Cut(claims.Email, "@")
+	}
+
+	user := &data.User{
+		Username:  truncate(username, 200),
+		Email:     claims.Email,
+		Activated: true,
+	}
+	password, err := oidc.RandomString()
+	if err != nil {
+		return nil, err
+	}
+	err = user.Password.Set(password)
+	if err != nil {
+		return nil, err
+	}
+
+	v := validator.New()
+	data.ValidateUser(v, user)
+	if !v.IsEmpty() {
+		return nil, errOIDCInvalidProfile
+	}
+
+	err = a.UserModel.Insert(user)
+	if err != nil {
+		return nil, err
+	}
+	err = a.PermissionModel.AddForUser(user.ID, "books:read")
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
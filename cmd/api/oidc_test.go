@@ -0,0 +1,169 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/luigiacunaUB/cmps4191-test-3/internal/data"
+	"github.com/luigiacunaUB/cmps4191-test-3/internal/oidc"
+	"github.com/luigiacunaUB/cmps4191-test-3/internal/oidc/oidctest"
+)
+
+// newTestOIDCApplication is a test application logging in through a fake provider
+func newTestOIDCApplication(t *testing.T) (*applicationDependencies, *sql.DB, *oidctest.Server) {
+	t.Helper()
+	a, db := newTestApplication(t)
+
+	server, err := oidctest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(server.Close)
+	a.oidc, err = oidc.New(oidc.Config{
+		IssuerURL:   server.URL,
+		ClientID:    oidctest.ClientID,
+		RedirectURL: "http://localhost:4000/v1/oidc/callback",
+		HTTPClient:  server.Client(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a, db, server
+}
+
+// oidcLogin runs a login through the API and the provider and returns the callback's response
+func oidcLogin(t *testing.T, a *applicationDependencies, server *oidctest.Server, token oidctest.IDToken) *httptest.ResponseRecorder {
+	t.Helper()
+	w := httptest.NewRecorder()
+	a.oidcLoginHandler(w, httptest.NewRequest(http.MethodGet, "/v1/oidc/login", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("login: status %d: %s", w.Code, w.Body)
+	}
+	var started struct {
+		AuthorizationURL string `json:"authorization_url"`
+	}
+	decodeResponse(t, w, &started)
+
+	code, state, err := server.Login(started.AuthorizationURL, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return oidcCallback(a, code, state)
+}
+
+func oidcCallback(a *applicationDependencies, code, state string) *httptest.ResponseRecorder {
+	query := url.Values{"code": {code}, "state": {state}}
+	w := httptest.NewRecorder()
+	a.oidcCallbackHandler(w, httptest.NewRequest(http.MethodGet, "/v1/oidc/callback?"+query.Encode(), nil))
+	return w
+}
+
+func loggedInUser(t *testing.T, w *httptest.ResponseRecorder) *data.User {
+	t.Helper()
+	if w.Code != http.StatusCreated {
+		t.Fatalf("callback: status %d: %s", w.Code, w.Body)
+	}
+	var response struct {
+		User data.User `json:"user"`
+	}
+	decodeResponse(t, w, &response)
+	return &response.User
+}
+
+func TestOIDCCreatesAndFindsUser(t *testing.T) {
+	a, db, server := newTestOIDCApplication(t)
+	email := testEmail(t, db, "oidc-new")
+	token := oidctest.IDToken{Subject: email, Email: email, EmailVerified: true, PreferredUsername: "new reader"}
+
+	created := loggedInUser(t, oidcLogin(t, a, server, token))
+	if created.Email != email || !created.Activated || created.Username != "new reader" {
+		t.Errorf("created user %+v", created)
+	}
+
+	again := loggedInUser(t, oidcLogin(t, a, server, token))
+	if again.ID != created.ID {
+		t.Errorf("second login got user %d, want %d", again.ID, created.ID)
+	}
+}
+
+func TestOIDCLinksExistingUser(t *testing.T) {
+	a, db, server := newTestOIDCApplication(t)
+	email := testEmail(t, db, "oidc-existing")
+
+	existing := &data.User{Username: "existing reader", Email: email}
+	err := existing.Password.Set("a password of the user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = a.UserModel.Insert(existing)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unverified := oidctest.IDToken{Subject: email, Email: email}
+	w := oidcLogin(t, a, server, unverified)
+	if w.Code != http.StatusConflict {
+		t.Errorf("unverified email: status %d, want %d", w.Code, http.StatusConflict)
+	}
+
+	verified := oidctest.IDToken{Subject: email, Email: email, EmailVerified: true}
+	linked := loggedInUser(t, oidcLogin(t, a, server, verified))
+	if linked.ID != existing.ID || !linked.Activated {
+		t.Errorf("linked user %+v, want user %d activated", linked, existing.ID)
+	}
+}
+
+func TestOIDCRejectsBadState(t *testing.T) {
+	a, db, server := newTestOIDCApplication(t)
+	email := testEmail(t, db, "oidc-state")
+
+	w := oidcCallback(a, "some-code", "a-state-the-api-never-issued")
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("unknown state: status %d, want %d", w.Code, http.StatusUnprocessableEntity)
+	}
+
+	// A state is used up by its callback, replaying it fails even with a fresh code
+	token := oidctest.IDToken{Subject: email, Email: email, EmailVerified: true}
+	w = httptest.NewRecorder()
+	a.oidcLoginHandler(w, httptest.NewRequest(http.MethodGet, "/v1/oidc/login", nil))
+	var started struct {
+		AuthorizationURL string `json:"authorization_url"`
+	}
+	decodeResponse(t, w, &started)
+	code, state, err := server.Login(started.AuthorizationURL, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loggedInUser(t, oidcCallback(a, code, state))
+
+	code, _, err = server.Login(started.AuthorizationURL, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w = oidcCallback(a, code, state)
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("replayed state: status %d, want %d", w.Code, http.StatusUnprocessableEntity)
+	}
+}
+
+func TestOIDCRejectsInvalidIDToken(t *testing.T) {
+	a, _, server := newTestOIDCApplication(t)
+
+	tests := []struct {
+		name  string
+		token oidctest.IDToken
+	}{
+		{"wrong nonce", oidctest.IDToken{Subject: "someone", Nonce: "another-login"}},
+		{"wrong audience", oidctest.IDToken{Subject: "someone", Audience: "another-client"}},
+		{"expired", oidctest.IDToken{Subject: "someone", Expired: true}},
+	}
+	for _, tt := range tests {
+		w := oidcLogin(t, a, server, tt.token)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("%s: status %d, want %d", tt.name, w.Code, http.StatusUnauthorized)
+		}
+	}
+}
@@ -1,10 +1,13 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/luigiacunaUB/cmps4191-test-3/internal/data"
 	"github.com/luigiacunaUB/cmps4191-test-3/internal/validator"
@@ -16,27 +19,33 @@ func (a *applicationDependencies) AddReadingList(w http.ResponseWriter, r *http.
 	//accept the incoming data
 	var incomingData struct {
 		ReadListName string `json:"name"`
-		Books        []int  `json:"book_name"`
-		CreatedBy    int    `json:"createdby"`
+		Books        []int  `json:"book_ids"`
 		Description  string `json:"description"`
-		Status       string `json:"status"`
+		Visibility   string `json:"visibility"`
 	}
 	//check if the data is correctly formed
 	err := a.readJSON(w, r, &incomingData)
 	if err != nil {
 		a.badRequestResponse(w, r, err)
+		return
 	}
-	//assign the incoming data to a ReadingListModel
+	//assign the incoming data to a ReadingListModel, the list belongs to whoever is logged in
 	list := &data.ReadingList{
 		ReadListName: incomingData.ReadListName,
 		Books:        incomingData.Books,
 		Description:  incomingData.Description,
-		Status:       incomingData.Status,
-		CreatedBy:    incomingData.CreatedBy,
+		Visibility:   incomingData.Visibility,
+		CreatedBy:    a.contextGetUser(r).ID,
+	}
+	if list.Visibility == "" {
+		list.Visibility = data.VisibilityPublic
 	}
 
 	//do validation
 	v := validator.New()
+	var nameFlags, descriptionFlags []string
+	list.ReadListName, nameFlags = a.filterContent(v, "Title", list.ReadListName)
+	list.Description, descriptionFlags = a.filterContent(v, "Description", list.Description)
 	data.ValidateReadingList(v, a.ReadingListModel, list)
 	if !v.IsEmpty() {
 		a.failedValidationResponse(w, r, v.Errors)
@@ -44,11 +53,13 @@ func (a *applicationDependencies) AddReadingList(w http.ResponseWriter, r *http.
 	}
 	logger.Info("Error Here 1")
 	//once the validation passes do the push to DB execution
-	ans, err := a.ReadingListModel.AddReadingListToDatabase(*list)
+	ans, results, err := a.ReadingListModel.AddReadingListToDatabase(*list)
 	if err != nil {
 		logger.Info("Error Here 2")
-		a.serverErrorResponse(w, r, err)
+		a.bookChangesErrorResponse(w, r, results, err)
+		return
 	}
+	a.flagContent(r, data.ContentTypeReadingList, ans.ID, append(nameFlags, descriptionFlags...))
 	logger.Info("Error Here 3")
 
 	data := envelope{
@@ -57,6 +68,7 @@ func (a *applicationDependencies) AddReadingList(w http.ResponseWriter, r *http.
 		"Created By User": ans.CreatedBy,
 		"Description":     ans.Description,
 		"Status":          ans.Status,
+		"Visibility":      ans.Visibility,
 	}
 
 	err = a.writeJSON(w, http.StatusCreated, data, nil)
@@ -70,22 +82,33 @@ func (a *applicationDependencies) AddReadingList(w http.ResponseWriter, r *http.
 func (a *applicationDependencies) DeleteReadingListHandler(w http.ResponseWriter, r *http.Request) {
 	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
 	logger.Info("Inside DELETEREADINGLISTHANDLER")
-	// Extract the reading list ID from the URL
-	id, err := a.readIDParam(r)
-	if err != nil {
-		a.notFoundResponse(w, r)
+	// Load the reading list named in the URL
+	list, _, ok := a.readingListForUser(w, r)
+	if !ok {
+		return
+	}
+	logger.Info("ID to be deleted", "id", list.ID)
+
+	// Only the owner can delete a list
+	if !list.IsOwner(a.contextGetUser(r).ID) {
+		a.notPermittedResponse(w, r)
 		return
 	}
-	logger.Info("ID to be deleted: ", id)
 
-	err = a.ReadingListModel.DeleteReadingList(id)
+	err := a.ReadingListModel.DeleteReadingList(list.ID)
 	if err != nil {
-		a.serverErrorResponse(w, r, err)
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
 	}
 
 	// Respond with a success message
 	err = a.writeJSON(w, http.StatusOK, envelope{
-		"message": fmt.Sprintf("Reading list successfully deleted. ID: %d", id),
+		"message": fmt.Sprintf("Reading list successfully deleted. ID: %d", list.ID),
 	}, nil)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
@@ -94,12 +117,15 @@ func (a *applicationDependencies) DeleteReadingListHandler(w http.ResponseWriter
 
 // ---------------------------------------------------------------------------------------------------------------------------------------------------------------
 func (a *applicationDependencies) ListAllReadingListsHandler(w http.ResponseWriter, r *http.Request) {
-	// Fetch all reading lists
-	readingLists, err := a.ReadingListModel.GetAllReadingLists()
+	// Fetch the public reading lists and the caller's own
+	readingLists, err := a.ReadingListModel.GetAllReadingLists(a.contextGetUser(r).ID)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 		return
 	}
+	if !a.expandReadingLists(w, r, readingLists) {
+		return
+	}
 
 	// Respond with the reading lists
 	err = a.writeJSON(w, http.StatusOK, envelope{
@@ -112,31 +138,22 @@ func (a *applicationDependencies) ListAllReadingListsHandler(w http.ResponseWrit
 
 // ----------------------------------------------------------------------------------------------------------------------------------------------------------------
 func (a *applicationDependencies) GetReadingListHandler(w http.ResponseWriter, r *http.Request) {
-	// Extract the reading list ID from the URL
-	id, err := a.readIDParam(r)
-	if err != nil {
-		a.notFoundResponse(w, r)
+	// Retrieve the specific reading list, private lists are only shown to their owner and collaborators
+	readingList, _, ok := a.readingListForUser(w, r)
+	if !ok {
 		return
 	}
-
-	// Retrieve the specific reading list from the model
-	readingList, err := a.ReadingListModel.GetReadingListByID(id)
-	if err != nil {
-		// Handle the error (not found or other)
-		if err.Error() == fmt.Sprintf("Reading list with ID %d not found", id) {
-			a.notFoundResponse(w, r)
-		} else {
-			a.serverErrorResponse(w, r, err)
-		}
+	lists := []data.ReadingList{*readingList}
+	if !a.expandReadingLists(w, r, lists) {
 		return
 	}
 
 	// Respond with the reading list in JSON format
 	data := envelope{
-		"reading_list": readingList,
+		"reading_list": lists[0],
 	}
 
-	err = a.writeJSON(w, http.StatusOK, data, nil)
+	err := a.writeJSON(w, http.StatusOK, data, nil)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 	}
@@ -144,33 +161,56 @@ func (a *applicationDependencies) GetReadingListHandler(w http.ResponseWriter, r
 
 // ------------------------------------------------------------------------------------------------------------------------------------------------
 func (a *applicationDependencies) AddBookToReadingListHandler(w http.ResponseWriter, r *http.Request) {
-	// Extract the reading list ID from the URL
-	id, err := a.readIDParam(r)
-	if err != nil {
-		a.notFoundResponse(w, r)
+	// Load the reading list named in the URL, its owner and editors can change the books on it
+	list, role, ok := a.readingListForUser(w, r)
+	if !ok {
+		return
+	}
+	if !data.CanEditBooks(role) {
+		a.notPermittedResponse(w, r)
 		return
 	}
 
-	// Parse the request body to get the book ID
+	// Parse the request body, either a single book_id or a book_ids array, and optionally where on the list they go
 	var incomingData struct {
-		BookID int64 `json:"book_id"`
+		BookID       int64   `json:"book_id"`
+		BookIDs      []int64 `json:"book_ids"`
+		Position     int     `json:"position"`
+		AllOrNothing bool    `json:"all_or_nothing"`
 	}
-	err = a.readJSON(w, r, &incomingData)
+	err := a.readJSON(w, r, &incomingData)
 	if err != nil {
 		a.badRequestResponse(w, r, err)
 		return
 	}
 
-	// Add the book to the reading list
-	err = a.ReadingListModel.AddBookToReadingList(id, incomingData.BookID)
+	v := validator.New()
+	bookIDs := validateBookIDs(v, incomingData.BookID, incomingData.BookIDs)
+	v.Check(incomingData.Position >= 0, "position", "must be a positive integer")
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Add the books to the reading list, no position adds them at the end
+	results, err := a.ReadingListModel.AddBooksToReadingList(list.ID, bookIDs, incomingData.Position, incomingData.AllOrNothing)
 	if err != nil {
-		a.serverErrorResponse(w, r, err)
+		a.bookChangesErrorResponse(w, r, results, err)
 		return
 	}
 
-	// Respond with success message
+	var added []int64
+	for _, result := range results {
+		if result.Result == data.BookAdded {
+			added = append(added, result.BookID)
+		}
+	}
+	a.notifyListFollowers(list, added, a.contextGetUser(r).ID)
+
+	// Respond with what happened to each book
 	data := envelope{
-		"message": "Book successfully added to reading list",
+		"message": fmt.Sprintf("%d of %d books added to reading list", len(added), len(bookIDs)),
+		"results": results,
 	}
 
 	err = a.writeJSON(w, http.StatusOK, data, nil)
@@ -181,33 +221,53 @@ func (a *applicationDependencies) AddBookToReadingListHandler(w http.ResponseWri
 
 // ---------------------------------------------------------------------------------------------------------------------------------------------------------------
 func (a *applicationDependencies) DeleteBookFromReadingListHandler(w http.ResponseWriter, r *http.Request) {
-	// Extract the reading list ID from the URL
-	id, err := a.readIDParam(r)
-	if err != nil {
-		a.notFoundResponse(w, r)
+	// Load the reading list named in the URL, its owner and editors can change the books on it
+	list, role, ok := a.readingListForUser(w, r)
+	if !ok {
+		return
+	}
+	if !data.CanEditBooks(role) {
+		a.notPermittedResponse(w, r)
 		return
 	}
 
-	// Parse the request body to get the book ID
+	// Parse the request body, either a single book_id or a book_ids array
 	var incomingData struct {
-		BookID int64 `json:"book_id"`
+		BookID       int64   `json:"book_id"`
+		BookIDs      []int64 `json:"book_ids"`
+		AllOrNothing bool    `json:"all_or_nothing"`
 	}
-	err = a.readJSON(w, r, &incomingData)
+	err := a.readJSON(w, r, &incomingData)
 	if err != nil {
 		a.badRequestResponse(w, r, err)
 		return
 	}
 
-	// Delete the book from the reading list
-	err = a.ReadingListModel.DeleteBookFromReadingList(id, incomingData.BookID)
+	v := validator.New()
+	bookIDs := validateBookIDs(v, incomingData.BookID, incomingData.BookIDs)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Remove the books from the reading list
+	results, err := a.ReadingListModel.RemoveBooksFromReadingList(list.ID, bookIDs, incomingData.AllOrNothing)
 	if err != nil {
-		a.serverErrorResponse(w, r, err)
+		a.bookChangesErrorResponse(w, r, results, err)
 		return
 	}
 
-	// Respond with a success message
+	removed := 0
+	for _, result := range results {
+		if result.Result == data.BookRemoved {
+			removed++
+		}
+	}
+
+	// Respond with what happened to each book
 	data := envelope{
-		"message": "Book successfully removed from reading list",
+		"message": fmt.Sprintf("%d of %d books removed from reading list", removed, len(bookIDs)),
+		"results": results,
 	}
 
 	err = a.writeJSON(w, http.StatusOK, data, nil)
@@ -216,12 +276,52 @@ func (a *applicationDependencies) DeleteBookFromReadingListHandler(w http.Respon
 	}
 }
 
+// maxBulkBooks caps how many books one request can add or remove
+const maxBulkBooks = 100
+
+// validateBookIDs returns the books a bulk add or remove is about, a single book_id is treated as a list of one
+func validateBookIDs(v *validator.Validator, bookID int64, bookIDs []int64) []int64 {
+	if bookID != 0 {
+		v.Check(bookIDs == nil, "book_ids", "must not be provided together with book_id")
+		bookIDs = []int64{bookID}
+	}
+	v.Check(len(bookIDs) > 0, "book_ids", "must contain at least one book id")
+	v.Check(len(bookIDs) <= maxBulkBooks, "book_ids", fmt.Sprintf("must not contain more than %d book ids", maxBulkBooks))
+
+	seen := make(map[int64]bool, len(bookIDs))
+	for _, id := range bookIDs {
+		v.Check(id > 0, "book_ids", "must only contain positive integers")
+		v.Check(!seen[id], "book_ids", "must not contain duplicate book ids")
+		seen[id] = true
+	}
+	return bookIDs
+}
+
+// bookChangesErrorResponse reports a failed bulk add or remove; when all_or_nothing stopped the change the
+// per book results are sent back so the client can see which books were the problem
+func (a *applicationDependencies) bookChangesErrorResponse(w http.ResponseWriter, r *http.Request, results []data.BookChange, err error) {
+	switch {
+	case errors.Is(err, data.ErrRecordNotFound):
+		a.notFoundResponse(w, r)
+	case errors.Is(err, data.ErrBulkIncomplete):
+		err = a.writeJSON(w, http.StatusUnprocessableEntity, envelope{"error": err.Error(), "results": results}, nil)
+		if err != nil {
+			a.serverErrorResponse(w, r, err)
+		}
+	default:
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
 // ------------------------------------------------------------------------------------------------------------------------------------
 func (a *applicationDependencies) UpdateReadingListInfoHandler(w http.ResponseWriter, r *http.Request) {
-	// Extract the reading list ID from the URL
-	id, err := a.readIDParam(r)
-	if err != nil {
-		a.notFoundResponse(w, r)
+	// Load the reading list named in the URL, only its owner can change it
+	list, _, ok := a.readingListForUser(w, r)
+	if !ok {
+		return
+	}
+	if !list.IsOwner(a.contextGetUser(r).ID) {
+		a.notPermittedResponse(w, r)
 		return
 	}
 
@@ -229,28 +329,47 @@ func (a *applicationDependencies) UpdateReadingListInfoHandler(w http.ResponseWr
 	var incomingData struct {
 		Name        string `json:"name"`
 		Description string `json:"description"`
-		Status      string `json:"status"`
+		Visibility  string `json:"visibility"`
 	}
-	err = a.readJSON(w, r, &incomingData)
+	err := a.readJSON(w, r, &incomingData)
 	if err != nil {
 		a.badRequestResponse(w, r, err)
 		return
 	}
 
 	// Construct the ReadingList struct with the updates
-	list := &data.ReadingList{
-		ID:           id,
+	update := &data.ReadingList{
+		ID:           list.ID,
 		ReadListName: incomingData.Name,
 		Description:  incomingData.Description,
-		Status:       incomingData.Status,
+		Visibility:   incomingData.Visibility,
+	}
+
+	// Run the new name and description through the content filters
+	v := validator.New()
+	if update.Visibility != "" {
+		data.ValidateVisibility(v, update.Visibility)
+	}
+	var nameFlags, descriptionFlags []string
+	if update.ReadListName != "" {
+		update.ReadListName, nameFlags = a.filterContent(v, "Title", update.ReadListName)
+		data.ValidateReadingListName(v, update.ReadListName)
+	}
+	if update.Description != "" {
+		update.Description, descriptionFlags = a.filterContent(v, "Description", update.Description)
+	}
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
 	}
 
 	// Update the reading list info
-	err = a.ReadingListModel.UpdateReadingListInfo(*list)
+	err = a.ReadingListModel.UpdateReadingListInfo(*update)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 		return
 	}
+	a.flagContent(r, data.ContentTypeReadingList, update.ID, append(nameFlags, descriptionFlags...))
 
 	// Respond with a success message
 	data := envelope{
@@ -261,3 +380,291 @@ func (a *applicationDependencies) UpdateReadingListInfoHandler(w http.ResponseWr
 		a.serverErrorResponse(w, r, err)
 	}
 }
+
+// expandReadingLists handles the expand query parameter of the reading list endpoints. With ?expand=books every
+// entry gets its full book, loaded for all of the lists at once. It writes the error response itself and returns
+// false when something went wrong.
+func (a *applicationDependencies) expandReadingLists(w http.ResponseWriter, r *http.Request, lists []data.ReadingList) bool {
+	expand := a.getSingleQueryParameter(r.URL.Query(), "expand", "")
+	if expand == "" {
+		return true
+	}
+
+	v := validator.New()
+	for _, value := range strings.Split(expand, ",") {
+		v.Check(validator.PermittedValue(strings.TrimSpace(value), "books"), "expand", "invalid expand value, only 'books' is supported")
+	}
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return false
+	}
+
+	books, err := a.BookModel.GetBooksByIDs(data.BookIDs(lists))
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return false
+	}
+	data.AttachBooks(lists, books)
+	return true
+}
+
+// readingListForUser loads the reading list named by the id parameter along with the current user's role on it,
+// and writes the error response itself when it can't. Lists the current user is not allowed to see are reported
+// as not found.
+func (a *applicationDependencies) readingListForUser(w http.ResponseWriter, r *http.Request) (*data.ReadingList, string, bool) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return nil, "", false
+	}
+
+	list, err := a.ReadingListModel.GetReadingListByID(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return nil, "", false
+	}
+
+	role, err := a.ReadingListModel.RoleFor(list, a.contextGetUser(r).ID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return nil, "", false
+	}
+
+	if !list.CanView(role) {
+		a.notFoundResponse(w, r)
+		return nil, "", false
+	}
+
+	return &list, role, true
+}
+
+// ------------------------------------------------------------------------------------------------------------------------------------
+func (a *applicationDependencies) UpdateReadingListEntryHandler(w http.ResponseWriter, r *http.Request) {
+	// Load the reading list named in the URL, only its owner tracks progress on it
+	list, _, ok := a.readingListForUser(w, r)
+	if !ok {
+		return
+	}
+	if !list.IsOwner(a.contextGetUser(r).ID) {
+		a.notPermittedResponse(w, r)
+		return
+	}
+
+	bookID, err := a.readNamedIDParam(r, "book_id")
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	entry, err := a.ReadingListModel.GetEntry(list.ID, bookID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Parse the request body, anything left out keeps its current value
+	var incomingData struct {
+		Status          *string    `json:"status"`
+		CurrentPage     *int       `json:"current_page"`
+		ProgressPercent *float64   `json:"progress_percent"`
+		StartedAt       *time.Time `json:"started_at"`
+		FinishedAt      *time.Time `json:"finished_at"`
+	}
+	err = a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	previousStatus := entry.Status
+	if incomingData.Status != nil {
+		entry.Status = *incomingData.Status
+	}
+	if incomingData.CurrentPage != nil {
+		entry.CurrentPage = incomingData.CurrentPage
+	}
+	if incomingData.ProgressPercent != nil {
+		entry.ProgressPercent = incomingData.ProgressPercent
+	}
+	if incomingData.StartedAt != nil {
+		entry.StartedAt = incomingData.StartedAt
+	}
+	if incomingData.FinishedAt != nil {
+		entry.FinishedAt = incomingData.FinishedAt
+	}
+
+	// Moving back clears the dates the old status had set, so a book taken off finished no longer counts
+	// towards goals and stats. Dates sent with the request are kept.
+	if entry.Status != previousStatus {
+		if entry.Status != data.EntryFinished && incomingData.FinishedAt == nil {
+			entry.FinishedAt = nil
+		}
+		if entry.Status == data.EntryWantToRead && incomingData.StartedAt == nil {
+			entry.StartedAt = nil
+		}
+	}
+
+	// Fill in the dates the client didn't send when the status moves on
+	now := time.Now()
+	if (entry.Status == data.EntryReading || entry.Status == data.EntryFinished) && entry.StartedAt == nil {
+		entry.StartedAt = &now
+	}
+	if entry.Status == data.EntryFinished && entry.FinishedAt == nil {
+		entry.FinishedAt = &now
+	}
+
+	v := validator.New()
+	data.ValidateReadingListEntry(v, &entry)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	listStatus, err := a.ReadingListModel.UpdateEntry(list.ID, entry)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{
+		"entry":       entry,
+		"list_status": listStatus,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// ------------------------------------------------------------------------------------------------------------------------------------
+func (a *applicationDependencies) ReorderReadingListHandler(w http.ResponseWriter, r *http.Request) {
+	// Load the reading list named in the URL, its owner and editors can change the books on it
+	list, role, ok := a.readingListForUser(w, r)
+	if !ok {
+		return
+	}
+	if !data.CanEditBooks(role) {
+		a.notPermittedResponse(w, r)
+		return
+	}
+
+	// The body lists every book on the list, first to last
+	var incomingData struct {
+		BookIDs []int64 `json:"book_ids"`
+	}
+	err := a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(incomingData.BookIDs != nil, "book_ids", "must be provided")
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = a.ReadingListModel.ReorderBooks(list.ID, incomingData.BookIDs)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrReadingListOrder):
+			v.AddError("book_ids", err.Error())
+			a.failedValidationResponse(w, r, v.Errors)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	readingList, err := a.ReadingListModel.GetReadingListByID(list.ID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = a.writeJSON(w, http.StatusOK, envelope{"reading_list": readingList}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// ------------------------------------------------------------------------------------------------------------------------------------
+func (a *applicationDependencies) CloneReadingListHandler(w http.ResponseWriter, r *http.Request) {
+	// Any list the user can see can be cloned
+	list, _, ok := a.readingListForUser(w, r)
+	if !ok {
+		return
+	}
+
+	// The body is optional, the clone keeps the original's name and is private unless told otherwise
+	var incomingData struct {
+		Name       string `json:"name"`
+		Visibility string `json:"visibility"`
+	}
+	if r.ContentLength != 0 {
+		err := a.readJSON(w, r, &incomingData)
+		if err != nil {
+			a.badRequestResponse(w, r, err)
+			return
+		}
+	}
+	if incomingData.Visibility == "" {
+		incomingData.Visibility = data.VisibilityPrivate
+	}
+
+	v := validator.New()
+	var nameFlags []string
+	if incomingData.Name != "" {
+		incomingData.Name, nameFlags = a.filterContent(v, "Title", incomingData.Name)
+		data.ValidateReadingListName(v, incomingData.Name)
+	}
+	data.ValidateVisibility(v, incomingData.Visibility)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	id, err := a.ReadingListModel.CloneReadingList(list.ID, a.contextGetUser(r).ID, incomingData.Name, incomingData.Visibility)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	a.flagContent(r, data.ContentTypeReadingList, id, nameFlags)
+
+	clone, err := a.ReadingListModel.GetReadingListByID(id)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/api/v1/lists/%d", id))
+
+	err = a.writeJSON(w, http.StatusCreated, envelope{"reading_list": clone}, headers)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"os"
 
 	"github.com/luigiacunaUB/cmps4191-test-3/internal/data"
+	"github.com/luigiacunaUB/cmps4191-test-3/internal/markdown"
 	"github.com/luigiacunaUB/cmps4191-test-3/internal/validator"
 )
 
@@ -32,6 +33,7 @@ func (a *applicationDependencies) AddBookReviewHandler(w http.ResponseWriter, r
 	err = a.readJSON(w, r, &incomingData)
 	if err != nil {
 		a.badRequestResponse(w, r, err)
+		return
 	}
 
 	review := &data.Review{
@@ -46,6 +48,10 @@ func (a *applicationDependencies) AddBookReviewHandler(w http.ResponseWriter, r
 	//do the validation checks
 	v := validator.New()
 
+	//run the review through the content filters
+	var flagReasons []string
+	review.Review, flagReasons = a.filterContent(v, "Review", review.Review)
+
 	//check if the book exist
 	data.ValidateBookIDOnly(v, a.BookModel, book)
 	//validate review
@@ -55,6 +61,13 @@ func (a *applicationDependencies) AddBookReviewHandler(w http.ResponseWriter, r
 		return
 	}
 
+	//render the markdown once so reads do not have to
+	review.ReviewHTML, err = markdown.Render(review.Review)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
 	//check if the user exist
 	_, ans, err := a.UserModel.GetID(incomingData.UserID)
 	if err != nil {
@@ -65,10 +78,10 @@ func (a *applicationDependencies) AddBookReviewHandler(w http.ResponseWriter, r
 
 	//check if an review already exist for a user for the specfic book
 	rcheck := a.ReviewModel.CheckIfReviewExistForUser(review.BookID, review.UserID)
-	logger.Info("Review Exist?: ", rcheck)
+	logger.Info("Review Exist?", "exists", rcheck)
 	if rcheck {
 		errmsg := "User has already reviewed this book" // Custom error message
-		logger.Info("Returning error: ", errmsg)        // Log the error message
+		logger.Info("Returning error", "error", errmsg) // Log the error message
 		http.Error(w, errmsg, http.StatusBadRequest)    // Send error response
 		return                                          // Stop further processing
 	}
@@ -77,10 +90,11 @@ func (a *applicationDependencies) AddBookReviewHandler(w http.ResponseWriter, r
 	results, err := a.ReviewModel.AddBookReview(*review)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
+		return
 	}
+	a.flagContent(r, data.ContentTypeReview, results.ID, flagReasons)
 
 	//create the headers
-	fmt.Fprintf(w, "%+v\n", incomingData)
 	headers := make(http.Header)
 	//making the apporiate header for GET /api/v1/books/api
 	headers.Set("Location", fmt.Sprintf("/api/v1/books/%d/reviews", results.ID))
@@ -90,8 +104,13 @@ func (a *applicationDependencies) AddBookReviewHandler(w http.ResponseWriter, r
 		"Review ID":                results.ID,
 		"Book ID":                  results.BookID,
 		"Review":                   results.Review,
+		"Review HTML":              results.ReviewHTML,
 		"Rating":                   results.Rating,
 		"Created By":               results.UserID,
+		"Review Date":              results.ReviewDate,
+		"Created At":               results.CreatedAt,
+		"Updated At":               results.UpdatedAt,
+		"Edited":                   results.Edited,
 	}
 
 	err = a.writeJSON(w, http.StatusCreated, data, headers)
@@ -111,7 +130,7 @@ func (a *applicationDependencies) UpdateBookReviewHandler(w http.ResponseWriter,
 		a.notFoundResponse(w, r)
 		return
 	}
-	logger.Info("UpdatedBookReviewHandler ID: ", id)
+	logger.Info("UpdatedBookReviewHandler", "id", id)
 
 	// set params for incoming data to be updated
 	var incomingData struct {
@@ -122,6 +141,7 @@ func (a *applicationDependencies) UpdateBookReviewHandler(w http.ResponseWriter,
 	err = a.readJSON(w, r, &incomingData)
 	if err != nil {
 		a.badRequestResponse(w, r, err)
+		return
 	}
 
 	review := &data.Review{
@@ -131,22 +151,42 @@ func (a *applicationDependencies) UpdateBookReviewHandler(w http.ResponseWriter,
 	}
 	//do the validation checks
 	v := validator.New()
+	//run the review through the content filters
+	var flagReasons []string
+	review.Review, flagReasons = a.filterContent(v, "Review", review.Review)
 	//validation checks
 	data.ValidateReview(v, a.ReviewModel, review)
 	if !v.IsEmpty() {
 		a.failedValidationResponse(w, r, v.Errors)
 		return
 	}
+	review.ReviewHTML, err = markdown.Render(review.Review)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
 	//once validation is done do the update
 	results, err := a.ReviewModel.UpdateReview(*review)
 	if err != nil {
-		a.serverErrorResponse(w, r, err)
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
 		return
 	}
+	a.flagContent(r, data.ContentTypeReview, results.ID, flagReasons)
 
 	data := envelope{
 		"Review Updated for ID": results.ID,
 		"New Review":            results.Review,
+		"Review HTML":           results.ReviewHTML,
+		"Rating":                results.Rating,
+		"Review Date":           results.ReviewDate,
+		"Created At":            results.CreatedAt,
+		"Updated At":            results.UpdatedAt,
+		"Edited":                results.Edited,
 	}
 
 	err = a.writeJSON(w, http.StatusCreated, data, nil)
@@ -193,7 +233,7 @@ func (a *applicationDependencies) DeleteReviewHandler(w http.ResponseWriter, r *
 		a.notFoundResponse(w, r)
 		return
 	}
-	logger.Info("DeleteBookReviewHandler ID: ", id)
+	logger.Info("DeleteBookReviewHandler", "id", id)
 
 	// Attempt to delete the review
 	results, err := a.ReviewModel.DeleteReview(id)
@@ -216,3 +256,112 @@ func (a *applicationDependencies) DeleteReviewHandler(w http.ResponseWriter, r *
 		a.serverErrorResponse(w, r, err)
 	}
 }
+
+// ---------------------------------------------------------------------------------------------------------------------------
+func (a *applicationDependencies) ListReviewHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	review, err := a.ReviewModel.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	//the history is only shown to the author and to moderators
+	user := a.contextGetUser(r)
+	if review.UserID != user.ID {
+		permissions, err := a.userPermissions(r)
+		if err != nil {
+			a.serverErrorResponse(w, r, err)
+			return
+		}
+		if !permissions.Include("reviews:moderate") {
+			a.notPermittedResponse(w, r)
+			return
+		}
+	}
+
+	revisions, err := a.ReviewModel.GetRevisions(review.ID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = a.writeJSON(w, http.StatusOK, envelope{"review": review, "revisions": revisions}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// ---------------------------------------------------------------------------------------------------------------------------
+func (a *applicationDependencies) ListUserReviewsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	user, err := a.UserModel.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// users who keep their reviews private only see them through /me/reviews
+	if user.ReviewsPrivate && a.contextGetUser(r).ID != user.ID {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	a.listReviewsForUser(w, r, user.ID)
+}
+
+// ---------------------------------------------------------------------------------------------------------------------------
+func (a *applicationDependencies) ListMyReviewsHandler(w http.ResponseWriter, r *http.Request) {
+	user := a.contextGetUser(r)
+	a.listReviewsForUser(w, r, user.ID)
+}
+
+// listReviewsForUser writes one page of the user's reviews, each with a summary of its book
+func (a *applicationDependencies) listReviewsForUser(w http.ResponseWriter, r *http.Request, userID int64) {
+	var filters data.Filters
+
+	queryParameters := r.URL.Query()
+
+	v := validator.New()
+	filters.Page = a.getSingleIntegerParameter(queryParameters, "page", 1, v)
+	filters.PageSize = a.getSingleIntegerParameter(queryParameters, "page_size", 10, v)
+	filters.Sort = a.getSingleQueryParameter(queryParameters, "sort", "-id")
+	filters.SortSafeList = []string{"id", "rating", "-id", "-rating"}
+
+	data.ValidateFilters(v, filters)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	reviews, metadata, err := a.ReviewModel.GetAllForUser(userID, filters)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = a.writeJSON(w, http.StatusOK, envelope{"reviews": reviews, "@metadata": metadata}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
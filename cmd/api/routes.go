@@ -23,27 +23,81 @@ func (a *applicationDependencies) routes() http.Handler {
 	//-------------------------------------BOOKS--------------------------------------------------------------------------------------------------------------------------------
 	router.HandlerFunc(http.MethodPost, "/api/v1/books", a.requirePermission("books:write", a.AddBookHandler))          //add a book
 	router.HandlerFunc(http.MethodGet, "/api/v1/books/search", a.requirePermission("books:read", a.SearchFunction))     //search for book based on title/author/genre
+	router.HandlerFunc(http.MethodGet, "/api/v1/books/top", a.requirePermission("books:read", a.TopRatedBooksHandler))  //top rated books by genre and period
 	router.HandlerFunc(http.MethodPut, "/api/v1/books/:id", a.requirePermission("books:write", a.UpdateBookHandler))    //Update a book
 	router.HandlerFunc(http.MethodDelete, "/api/v1/books/:id", a.requirePermission("books:write", a.DeleteBookHandler)) //Delete a book
 	router.HandlerFunc(http.MethodGet, "/api/v1/book/:id", a.requirePermission("books:read", a.ListBookHandler))        //list a single book
 	router.HandlerFunc(http.MethodGet, "/api/v1/books", a.requirePermission("books:read", a.ListAllHandler))            //list all books
 	//---------------------------------------READING LIST--------------------------------------------------------------------------------
-	router.HandlerFunc(http.MethodPost, "/api/v1/list", a.requirePermission("books:write", a.AddReadingList))                                //create a reading list
-	router.HandlerFunc(http.MethodDelete, "/api/v1/lists/:id", a.requirePermission("books:write", a.DeleteReadingListHandler))               //delete a reading list
-	router.HandlerFunc(http.MethodGet, "/api/v1/lists", a.requirePermission("books:read", a.ListAllReadingListsHandler))                     //view all the reading list
-	router.HandlerFunc(http.MethodGet, "/api/v1/lists/:id", a.requirePermission("books:read", a.GetReadingListHandler))                      //view specfic readling list
-	router.HandlerFunc(http.MethodPost, "/api/v1/lists/:id/books", a.requirePermission("books:write", a.AddBookToReadingListHandler))        //add a book to a specfic reading list
-	router.HandlerFunc(http.MethodDelete, "/api/v1/lists/:id/books", a.requirePermission("books:write", a.DeleteBookFromReadingListHandler)) //delete a book to a specfic reading list
-	router.HandlerFunc(http.MethodPut, "/api/v1/lists/:id", a.requirePermission("books:write", a.UpdateReadingListInfoHandler))              //update a reading list
+	router.HandlerFunc(http.MethodPost, "/api/v1/list", a.requirePermission("books:write", a.AddReadingList))                                         //create a reading list
+	router.HandlerFunc(http.MethodDelete, "/api/v1/lists/:id", a.requirePermission("books:write", a.DeleteReadingListHandler))                        //delete a reading list
+	router.HandlerFunc(http.MethodGet, "/api/v1/lists", a.requirePermission("books:read", a.ListAllReadingListsHandler))                              //view all the reading list
+	router.HandlerFunc(http.MethodGet, "/api/v1/lists/:id", a.requirePermission("books:read", a.GetReadingListHandler))                               //view specfic readling list
+	router.HandlerFunc(http.MethodPost, "/api/v1/lists/:id/books", a.requirePermission("books:write", a.AddBookToReadingListHandler))                 //add a book to a specfic reading list
+	router.HandlerFunc(http.MethodDelete, "/api/v1/lists/:id/books", a.requirePermission("books:write", a.DeleteBookFromReadingListHandler))          //delete a book to a specfic reading list
+	router.HandlerFunc(http.MethodPut, "/api/v1/lists/:id", a.requirePermission("books:write", a.UpdateReadingListInfoHandler))                       //update a reading list
+	router.HandlerFunc(http.MethodPut, "/api/v1/lists/:id/order", a.requirePermission("books:write", a.ReorderReadingListHandler))                    //reorder the books on a reading list
+	router.HandlerFunc(http.MethodPatch, "/api/v1/lists/:id/books/:book_id", a.requirePermission("books:write", a.UpdateReadingListEntryHandler))     //update the reading status of a book on a list
+	router.HandlerFunc(http.MethodPost, "/api/v1/lists/:id/clone", a.requirePermission("books:write", a.CloneReadingListHandler))                     //copy a reading list into a new list owned by the caller
+	router.HandlerFunc(http.MethodGet, "/api/v1/lists/:id/collaborators", a.requirePermission("books:read", a.ListCollaboratorsHandler))              //list who a reading list is shared with
+	router.HandlerFunc(http.MethodPost, "/api/v1/lists/:id/collaborators", a.requirePermission("books:read", a.AddCollaboratorHandler))               //invite an email address to collaborate on a reading list
+	router.HandlerFunc(http.MethodPut, "/api/v1/lists/:id/collaborators/accept", a.requirePermission("books:read", a.AcceptInvitationHandler))        //accept an invitation sent to the logged in user's email address
+	router.HandlerFunc(http.MethodDelete, "/api/v1/lists/:id/collaborators/:user_id", a.requirePermission("books:read", a.RemoveCollaboratorHandler)) //stop sharing a reading list with a user
+	router.HandlerFunc(http.MethodPost, "/api/v1/lists/:id/follow", a.requirePermission("books:read", a.FollowReadingListHandler))                    //follow a reading list
+	router.HandlerFunc(http.MethodDelete, "/api/v1/lists/:id/follow", a.requirePermission("books:read", a.UnfollowReadingListHandler))                //unfollow a reading list
+	router.HandlerFunc(http.MethodGet, "/api/v1/me/following", a.requirePermission("books:read", a.ListFollowedReadingListsHandler))                  //list the reading lists the logged in user follows
 	//--------------------------------------REVIEWS-----------------------------------------------------------------------------------------------------------------------------
 	router.HandlerFunc(http.MethodPost, "/api/v1/books/:id/reviews", a.requirePermission("books:write", a.AddBookReviewHandler))     //add a review
-	router.HandlerFunc(http.MethodPut, "/api//v1/reviews/:id", a.requirePermission("books:write", a.UpdateBookReviewHandler))        //update review
+	router.HandlerFunc(http.MethodPut, "/api/v1/reviews/:id", a.requirePermission("books:write", a.UpdateBookReviewHandler))         //update review
 	router.HandlerFunc(http.MethodGet, "/api/v1/book/:id/reviews", a.requirePermission("books:read", a.ListAllReviewsByBookHandler)) //list all reviews by bookID
 	router.HandlerFunc(http.MethodDelete, "/api/v1/reviews/:id", a.requirePermission("books:read", a.DeleteReviewHandler))           //delete a review
+	router.HandlerFunc(http.MethodGet, "/api/v1/reviews/:id/history", a.requirePermission("books:read", a.ListReviewHistoryHandler)) //view the edit history of a review
+	router.HandlerFunc(http.MethodGet, "/api/v1/users/:id/reviews", a.requirePermission("books:read", a.ListUserReviewsHandler))     //list all reviews by a user
+	router.HandlerFunc(http.MethodGet, "/api/v1/me/reviews", a.requirePermission("books:read", a.ListMyReviewsHandler))              //list the reviews of the logged in user
+	//--------------------------------------GOALS AND STATS---------------------------------------------------------------------------------------------------------------------
+	router.HandlerFunc(http.MethodPost, "/api/v1/me/goals", a.requirePermission("books:read", a.CreateReadingGoalHandler))       //set a reading goal for a year
+	router.HandlerFunc(http.MethodGet, "/api/v1/me/goals", a.requirePermission("books:read", a.ListReadingGoalsHandler))         //list the logged in user's reading goals
+	router.HandlerFunc(http.MethodGet, "/api/v1/me/goals/:id", a.requirePermission("books:read", a.GetReadingGoalHandler))       //view a reading goal and its progress
+	router.HandlerFunc(http.MethodPatch, "/api/v1/me/goals/:id", a.requirePermission("books:read", a.UpdateReadingGoalHandler))  //change the target of a reading goal
+	router.HandlerFunc(http.MethodDelete, "/api/v1/me/goals/:id", a.requirePermission("books:read", a.DeleteReadingGoalHandler)) //delete a reading goal
+	router.HandlerFunc(http.MethodGet, "/api/v1/me/stats", a.requirePermission("books:read", a.ReadingStatsHandler))             //reading stats of the logged in user
+	//--------------------------------------IMPORT AND EXPORT---------------------------------------------------------------------------------------------------------------------
+	router.HandlerFunc(http.MethodPost, "/api/v1/me/import/goodreads", a.requirePermission("books:write", a.ImportGoodreadsHandler)) //import a Goodreads library export
+	router.HandlerFunc(http.MethodGet, "/api/v1/me/export/goodreads", a.requirePermission("books:read", a.ExportGoodreadsHandler))   //export the logged in user's books as a Goodreads CSV
+	//--------------------------------------MODERATION--------------------------------------------------------------------------------------------------------------------------
+	router.HandlerFunc(http.MethodGet, "/api/v1/moderation/flags", a.requirePermission("reviews:moderate", a.ListContentFlagsHandler))          //list flagged content
+	router.HandlerFunc(http.MethodDelete, "/api/v1/moderation/flags/:id", a.requirePermission("reviews:moderate", a.ResolveContentFlagHandler)) //resolve a flag
+	//--------------------------------------SETTINGS----------------------------------------------------------------------------------------------------------------------------
+	router.HandlerFunc(http.MethodGet, "/api/v1/settings", a.requirePermission("settings:manage", a.showSettingsHandler))     //view the site wide settings
+	router.HandlerFunc(http.MethodPatch, "/api/v1/settings", a.requirePermission("settings:manage", a.updateSettingsHandler)) //change the site wide settings, such as requiring 2FA for writers
 	//--------------------------------------USERS-------------------------------------------------------------------------------------------------------------------------------
-	router.HandlerFunc(http.MethodPost, "/v1/users", a.registerUserHandler)                              //register a user
-	router.HandlerFunc(http.MethodPut, "/v1/users/activated", a.activateUserHandler)                     //activate a user
-	router.HandlerFunc(http.MethodPost, "/v1/tokens/authentication", a.createAuthenticationTokenHandler) //authenticate token
-	router.HandlerFunc(http.MethodPut, "/api/v1/reviews/:id", a.UpdateBookReviewHandler)                 //update a review
+	router.HandlerFunc(http.MethodPost, "/v1/users", a.registerUserHandler)                                                            //register a user
+	router.HandlerFunc(http.MethodPut, "/v1/users/activated", a.activateUserHandler)                                                   //activate a user
+	router.HandlerFunc(http.MethodGet, "/v1/users/me", a.requireActivatedUser(a.showCurrentUserHandler))                               //view the logged in user's account
+	router.HandlerFunc(http.MethodPatch, "/v1/users/me", a.requireActivatedUser(a.updateCurrentUserHandler))                           //update the logged in user's account
+	router.HandlerFunc(http.MethodPut, "/v1/users/me/password", a.requireActivatedUser(a.changeCurrentUserPasswordHandler))            //change password with the current password
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/export", a.requireAuthenticatedUser(a.exportAccountHandler))                      //download everything stored about the logged in user
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me", a.requireAuthenticatedUser(a.deleteAccountHandler))                          //delete or anonymize the logged in user's account
+	router.HandlerFunc(http.MethodPost, "/v1/users/me/api-keys", a.requireInteractiveUser(a.createAPIKeyHandler))                      //create an API key for scripts
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/api-keys", a.requireInteractiveUser(a.listAPIKeysHandler))                        //list the logged in user's API keys
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/api-keys/:id", a.requireInteractiveUser(a.deleteAPIKeyHandler))                //revoke an API key
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/2fa", a.requireInteractiveUser(a.showTwoFactorHandler))                           //show whether 2FA is enabled
+	router.HandlerFunc(http.MethodPost, "/v1/users/me/2fa", a.requireInteractiveUser(a.enrollTwoFactorHandler))                        //start 2FA enrollment, returns the secret and otpauth URI
+	router.HandlerFunc(http.MethodPut, "/v1/users/me/2fa", a.requireInteractiveUser(a.enableTwoFactorHandler))                         //confirm enrollment with a code, returns the recovery codes
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/2fa", a.requireInteractiveUser(a.disableTwoFactorHandler))                     //turn 2FA off
+	router.HandlerFunc(http.MethodPost, "/v1/users/me/2fa/recovery-codes", a.requireInteractiveUser(a.regenerateRecoveryCodesHandler)) //replace the recovery codes
+	router.HandlerFunc(http.MethodPut, "/v1/users/email", a.confirmEmailChangeHandler)                                                 //confirm a new email address
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/authentication", a.createAuthenticationTokenHandler)                               //authenticate token
+	router.HandlerFunc(http.MethodGet, "/v1/oidc/login", a.oidcLoginHandler)                                                           //start a login at the OpenID Connect provider
+	router.HandlerFunc(http.MethodGet, "/v1/oidc/callback", a.oidcCallbackHandler)                                                     //finish a provider login and get a token pair
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/2fa", a.createTwoFactorTokenHandler)                                               //answer a 2FA challenge with a code for a token pair
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/refresh", a.refreshAuthenticationTokenHandler)                                     //exchange a refresh token for a new token pair
+	router.HandlerFunc(http.MethodDelete, "/v1/tokens/authentication", a.requireAuthenticatedUser(a.deleteAuthenticationTokenHandler)) //log out, revoking the current token
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/sessions", a.requireAuthenticatedUser(a.listSessionsHandler))                     //list the logged in user's active sessions
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/sessions", a.requireAuthenticatedUser(a.deleteAllSessionsHandler))             //revoke every session of the logged in user
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/sessions/:id", a.requireAuthenticatedUser(a.deleteSessionHandler))             //revoke a single session
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/activation", a.createActivationTokenHandler)                                       //resend the activation email
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/password-reset", a.createPasswordResetTokenHandler)                                //request a password reset email
+	router.HandlerFunc(http.MethodPut, "/v1/users/password", a.updateUserPasswordHandler)                                              //set a new password with a reset token
 	return a.recoverPanic(a.rateLimit(a.authenticate(router)))
 }
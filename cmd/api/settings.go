@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/luigiacunaUB/cmps4191-test-3/internal/data"
+)
+
+// ------------------------------------------------------------------------------------------------------------------------------
+func (a *applicationDependencies) showSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	settings, err := a.SettingsModel.Get()
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = a.writeJSON(w, http.StatusOK, envelope{"settings": settings}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// ------------------------------------------------------------------------------------------------------------------------------
+func (a *applicationDependencies) updateSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	settings, err := a.SettingsModel.Get()
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Anything left out keeps its current value
+	var incomingData struct {
+		RequireTwoFactorForWriters *bool `json:"require_2fa_for_writers"`
+		Version                    *int  `json:"version"`
+	}
+	err = a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	// Clients that send the version they last saw get an edit conflict if another admin changed the settings since
+	if incomingData.Version != nil && *incomingData.Version != settings.Version {
+		a.editConflictResponse(w, r)
+		return
+	}
+	if incomingData.RequireTwoFactorForWriters != nil {
+		settings.RequireTwoFactorForWriters = *incomingData.RequireTwoFactorForWriters
+	}
+
+	err = a.SettingsModel.Update(settings)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			a.editConflictResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	a.logger.Info("settings changed", "user_id", a.contextGetUser(r).ID, "require_2fa_for_writers", settings.RequireTwoFactorForWriters)
+
+	err = a.writeJSON(w, http.StatusOK, envelope{"settings": settings}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
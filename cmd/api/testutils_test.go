@@ -0,0 +1,70 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/luigiacunaUB/cmps4191-test-3/internal/data"
+)
+
+// newTestApplication connects to the migrated database in BOOKSTORE_TEST_DB_DSN, tests that need one are
+// skipped when it isn't set
+func newTestApplication(t *testing.T) (*applicationDependencies, *sql.DB) {
+	t.Helper()
+	dsn := os.Getenv("BOOKSTORE_TEST_DB_DSN")
+	if dsn == "" {
+		t.Skip("BOOKSTORE_TEST_DB_DSN is not set")
+	}
+
+	var settings serverConfig
+	settings.db.dsn = dsn
+	settings.tokens.accessTTL = 15 * time.Minute
+	settings.tokens.refreshTTL = time.Hour
+	db, err := openDB(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return &applicationDependencies{
+		config:          settings,
+		logger:          slog.New(slog.NewTextHandler(io.Discard, nil)),
+		UserModel:       data.UserModel{DB: db},
+		TokenModel:      data.TokenModel{DB: db},
+		PermissionModel: data.PermissionModel{DB: db},
+		APIKeyModel:     data.APIKeyModel{DB: db},
+		IdentityModel:   data.IdentityModel{DB: db},
+		TwoFactorModel:  data.TwoFactorModel{DB: db},
+		SettingsModel:   data.SettingsModel{DB: db},
+		denylist:        &tokenDenylist{},
+	}, db
+}
+
+// testEmail returns an address no other test run uses, the user behind it is deleted when the test ends
+func testEmail(t *testing.T, db *sql.DB, name string) string {
+	t.Helper()
+	email := fmt.Sprintf("%s-%d@test.example.com", name, time.Now().UnixNano())
+	t.Cleanup(func() {
+		_, err := db.Exec(`DELETE FROM users WHERE email = $1`, email)
+		if err != nil {
+			t.Log(err)
+		}
+	})
+	return email
+}
+
+// decodeResponse reads the JSON body of a recorded response
+func decodeResponse(t *testing.T, w *httptest.ResponseRecorder, destination any) {
+	t.Helper()
+	err := json.NewDecoder(w.Body).Decode(destination)
+	if err != nil {
+		t.Fatalf("decoding %q: %v", w.Body.String(), err)
+	}
+}
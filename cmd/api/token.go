@@ -53,15 +53,31 @@ func (a *applicationDependencies) createAuthenticationTokenHandler(w http.Respon
 		a.invalidCredentialsResponse(w, r)
 		return
 	}
-	token, err := a.TokenModel.New(user.ID, 24*time.Hour, data.ScopeAuthentication)
+	// With 2FA on, the password alone only earns a challenge
+	twoFactorEnabled, err := a.TwoFactorModel.IsEnabled(user.ID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+	if twoFactorEnabled {
+		a.writeTwoFactorChallenge(w, r, user)
+		return
+	}
+	token, refreshToken, err := a.TokenModel.NewSession(user.ID, a.config.tokens.accessTTL, a.config.tokens.refreshTTL, clientIP(r), truncate(r.UserAgent(), 512))
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 		return
 
 	}
+	err = a.issueAccessToken(user, token)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
 
 	data := envelope{
 		"authentication_token": token,
+		"refresh_token":        refreshToken,
 		"Please use your ID when creating reviews and/or readinglist (YOUR USERID)": user.ID,
 	}
 
@@ -72,3 +88,261 @@ func (a *applicationDependencies) createAuthenticationTokenHandler(w http.Respon
 	}
 
 }
+
+// -------------------------------------------------------------------------------------------------------------------------------------
+func (a *applicationDependencies) refreshAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var incomingData struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	err := a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(incomingData.RefreshToken != "", "refresh_token", "must be provided")
+	v.Check(len(incomingData.RefreshToken) == 26, "refresh_token", "must be 26 bytes long")
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Every refresh token works once, the response carries the one to use next time
+	token, refreshToken, err := a.TokenModel.RotateRefreshToken(incomingData.RefreshToken, a.config.tokens.accessTTL, a.config.tokens.refreshTTL, clientIP(r), truncate(r.UserAgent(), 512))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.errorResponseJSON(w, r, http.StatusUnauthorized, "invalid or expired refresh token")
+		case errors.Is(err, data.ErrRefreshTokenReused):
+			a.logger.Warn("refresh token reused, session revoked", "ip", clientIP(r))
+			a.sessionsRevoked()
+			a.errorResponseJSON(w, r, http.StatusUnauthorized, "this refresh token was already used, the session has been revoked, please log in again")
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// The JWT carries the user's current details and permissions
+	user, err := a.UserModel.Get(token.UserID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+	err = a.issueAccessToken(user, token)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = a.writeJSON(w, http.StatusCreated, envelope{
+		"authentication_token": token,
+		"refresh_token":        refreshToken,
+	}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// -------------------------------------------------------------------------------------------------------------------------------------
+func (a *applicationDependencies) createPasswordResetTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var incomingData struct {
+		Email string `json:"email"`
+	}
+	err := a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	data.ValidateEmail(v, incomingData.Email)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := a.UserModel.GetByEmail(incomingData.Email)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if user != nil && user.Activated {
+		token, err := a.TokenModel.New(user.ID, 45*time.Minute, data.ScopePasswordReset)
+		if err != nil {
+			a.serverErrorResponse(w, r, err)
+			return
+		}
+
+		a.background(func() {
+			data := map[string]any{
+				"passwordResetToken": token.Plaintext,
+			}
+			err := a.mailer.Send(user.Email, "token_password_reset.tmpl", data)
+			if err != nil {
+				a.logger.Error(err.Error())
+			}
+		})
+	}
+
+	// The response is the same whether or not the email belongs to an account, so it
+	// can't be used to find out who has one
+	data := envelope{
+		"message": "if an activated account uses that email address, an email will be sent to it containing password reset instructions",
+	}
+
+	err = a.writeJSON(w, http.StatusAccepted, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// -------------------------------------------------------------------------------------------------------------------------------------
+func (a *applicationDependencies) createActivationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var incomingData struct {
+		Email string `json:"email"`
+	}
+	err := a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	data.ValidateEmail(v, incomingData.Email)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := a.UserModel.GetByEmail(incomingData.Email)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if user != nil && !user.Activated {
+		// Only the newest activation token works
+		err = a.TokenModel.DeleteAllForUser(data.ScopeActivation, user.ID)
+		if err != nil {
+			a.serverErrorResponse(w, r, err)
+			return
+		}
+
+		token, err := a.TokenModel.New(user.ID, 3*24*time.Hour, data.ScopeActivation)
+		if err != nil {
+			a.serverErrorResponse(w, r, err)
+			return
+		}
+
+		a.background(func() {
+			data := map[string]any{
+				"activationToken": token.Plaintext,
+				"userID":          user.ID,
+			}
+			err := a.mailer.Send(user.Email, "user_welcome.tmpl", data)
+			if err != nil {
+				a.logger.Error(err.Error())
+			}
+		})
+	}
+
+	// The response is the same whether the email is unknown, already activated or waiting
+	// for activation, so it can't be used to find out who has an account
+	data := envelope{
+		"message": "if an account waiting for activation uses that email address, an email will be sent to it containing activation instructions",
+	}
+
+	err = a.writeJSON(w, http.StatusAccepted, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// -------------------------------------------------------------------------------------------------------------------------------------
+func (a *applicationDependencies) deleteAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	// Logging out revokes the token the request was made with
+	err := a.TokenModel.DeleteSession(a.contextGetSessionID(r), a.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.invalidAuthenticationTokenResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	a.sessionsRevoked()
+
+	err = a.writeJSON(w, http.StatusOK, envelope{"message": "you have been logged out"}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// -------------------------------------------------------------------------------------------------------------------------------------
+func (a *applicationDependencies) listSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	sessions, err := a.TokenModel.GetSessionsForUser(a.contextGetUser(r).ID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	currentID := a.contextGetSessionID(r)
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == currentID
+	}
+
+	err = a.writeJSON(w, http.StatusOK, envelope{"sessions": sessions}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// -------------------------------------------------------------------------------------------------------------------------------------
+func (a *applicationDependencies) deleteSessionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	// Another user's session id is reported as not found
+	err = a.TokenModel.DeleteSession(id, a.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	a.sessionsRevoked()
+
+	err = a.writeJSON(w, http.StatusOK, envelope{"message": "the session was revoked"}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// -------------------------------------------------------------------------------------------------------------------------------------
+func (a *applicationDependencies) deleteAllSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	// Logs the user out everywhere, including the session this request was made with
+	err := a.TokenModel.DeleteSessionsForUser(a.contextGetUser(r).ID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	a.sessionsRevoked()
+
+	err = a.writeJSON(w, http.StatusOK, envelope{"message": "all of your sessions were revoked, please log in again"}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
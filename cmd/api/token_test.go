@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/luigiacunaUB/cmps4191-test-3/internal/data"
+	"github.com/luigiacunaUB/cmps4191-test-3/internal/jwtauth"
+)
+
+func TestRefreshTokenReuse(t *testing.T) {
+	a, db := newTestApplication(t)
+	keys, err := jwtauth.ParseKeySet("test:a-secret-long-enough-for-the-test-keys", "bookclub-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.jwtKeys = keys
+
+	user := &data.User{Username: "refreshing reader", Email: testEmail(t, db, "refresh-reuse"), Activated: true}
+	err = user.Password.Set("a password of the user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = a.UserModel.Insert(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, firstRefresh, err := a.TokenModel.NewSession(user.ID, a.config.tokens.accessTTL, a.config.tokens.refreshTTL, "192.0.2.1", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type tokenPair struct {
+		Access  struct{ Token string } `json:"authentication_token"`
+		Refresh struct{ Token string } `json:"refresh_token"`
+	}
+	refresh := func(refreshToken string) (int, tokenPair) {
+		w := httptest.NewRecorder()
+		body := `{"refresh_token": "` + refreshToken + `"}`
+		a.refreshAuthenticationTokenHandler(w, httptest.NewRequest(http.MethodPost, "/v1/tokens/refresh", strings.NewReader(body)))
+		var pair tokenPair
+		if w.Code == http.StatusCreated {
+			decodeResponse(t, w, &pair)
+		}
+		return w.Code, pair
+	}
+
+	status, rotated := refresh(firstRefresh.Plaintext)
+	if status != http.StatusCreated {
+		t.Fatalf("first refresh: status %d, want %d", status, http.StatusCreated)
+	}
+	claims, err := a.jwtKeys.Verify(rotated.Access.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.denylist.contains(claims.ID) {
+		t.Fatal("the new access token is on the denylist")
+	}
+
+	// The old refresh token being used again means it was copied, the whole session ends
+	status, _ = refresh(firstRefresh.Plaintext)
+	if status != http.StatusUnauthorized {
+		t.Errorf("reused refresh token: status %d, want %d", status, http.StatusUnauthorized)
+	}
+	status, _ = refresh(rotated.Refresh.Token)
+	if status != http.StatusUnauthorized {
+		t.Errorf("refresh token issued before the reuse: status %d, want %d", status, http.StatusUnauthorized)
+	}
+	if !a.denylist.contains(claims.ID) {
+		t.Error("the access token issued before the reuse is not on the denylist")
+	}
+	_, err = a.UserModel.GetForToken(data.ScopeRefresh, rotated.Refresh.Token)
+	if !errors.Is(err, data.ErrRecordNotFound) {
+		t.Errorf("refresh token issued before the reuse: err = %v, want it deleted", err)
+	}
+}
@@ -0,0 +1,465 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/luigiacunaUB/cmps4191-test-3/internal/data"
+	"github.com/luigiacunaUB/cmps4191-test-3/internal/totp"
+	"github.com/luigiacunaUB/cmps4191-test-3/internal/validator"
+)
+
+// twoFactorIssuer names the account in authenticator apps
+const twoFactorIssuer = "Book Club"
+
+// twoFactorChallengeTTL is how long a user has to enter their code after the password was accepted
+const twoFactorChallengeTTL = 5 * time.Minute
+
+// twoFactorRequired reports whether the route needs the user to have 2FA enabled, which admins turn on for
+// write routes with the require_2fa_for_writers setting. It is read on every write request so a change
+// applies to every instance of the API at once.
+func (a *applicationDependencies) twoFactorRequired(permissionCode string) (bool, error) {
+	if !strings.HasSuffix(permissionCode, ":write") {
+		return false, nil
+	}
+	settings, err := a.SettingsModel.Get()
+	if err != nil {
+		return false, err
+	}
+	return settings.RequireTwoFactorForWriters, nil
+}
+
+// writeTwoFactorChallenge answers a login of a user with 2FA enabled. The password was right, but instead of a
+// token pair the client gets a challenge token to send back with a code to POST /v1/tokens/2fa.
+func (a *applicationDependencies) writeTwoFactorChallenge(w http.ResponseWriter, r *http.Request, user *data.User) {
+	// Only the newest challenge is valid
+	err := a.TokenModel.DeleteAllForUser(data.ScopeTwoFactor, user.ID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+	challenge, err := a.TokenModel.New(user.ID, twoFactorChallengeTTL, data.ScopeTwoFactor)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = a.writeJSON(w, http.StatusAccepted, envelope{
+		"two_factor_required": true,
+		"challenge_token":     challenge,
+	}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// checkSecondFactor checks a TOTP code, or a recovery code when no TOTP code is given. Each code works once.
+// Wrong codes are counted and after too many it returns data.ErrTwoFactorLocked until the lock runs out,
+// whether the code is right or not.
+func (a *applicationDependencies) checkSecondFactor(userID int64, code, recoveryCode string) (bool, error) {
+	twoFactor, err := a.TwoFactorModel.Get(userID)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	if twoFactor.Locked() {
+		return false, data.ErrTwoFactorLocked
+	}
+
+	var ok bool
+	if code == "" {
+		ok, err = a.TwoFactorModel.UseRecoveryCode(userID, recoveryCode)
+	} else if step, valid := totp.Validate(twoFactor.Secret, code, time.Now()); valid {
+		ok, err = a.TwoFactorModel.UseStep(userID, step)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if !ok {
+		return false, a.TwoFactorModel.RecordFailure(userID)
+	}
+	return true, a.TwoFactorModel.ResetFailures(userID)
+}
+
+// validateSecondFactor checks that exactly one of code and recovery_code was sent
+func validateSecondFactor(v *validator.Validator, code, recoveryCode string) {
+	v.Check(code != "" || recoveryCode != "", "code", "must be provided, or a recovery_code instead")
+	v.Check(code == "" || recoveryCode == "", "recovery_code", "must not be sent along with a code")
+}
+
+// ------------------------------------------------------------------------------------------------------------------------------
+func (a *applicationDependencies) createTwoFactorTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var incomingData struct {
+		ChallengeToken string `json:"challenge_token"`
+		Code           string `json:"code"`
+		RecoveryCode   string `json:"recovery_code"`
+	}
+	err := a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(incomingData.ChallengeToken != "", "challenge_token", "must be provided")
+	v.Check(len(incomingData.ChallengeToken) == 26, "challenge_token", "must be 26 bytes long")
+	validateSecondFactor(v, incomingData.Code, incomingData.RecoveryCode)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := a.UserModel.GetForToken(data.ScopeTwoFactor, incomingData.ChallengeToken)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.errorResponseJSON(w, r, http.StatusUnauthorized, "invalid or expired challenge token, please log in again")
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// A challenge gets one guess, and checkSecondFactor locks the second factor after a few wrong ones, so the
+	// six digits can't be brute forced with one challenge or a stream of new ones
+	err = a.TokenModel.DeleteAllForUser(data.ScopeTwoFactor, user.ID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	ok, err := a.checkSecondFactor(user.ID, incomingData.Code, incomingData.RecoveryCode)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrTwoFactorLocked):
+			a.twoFactorLockedResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if !ok {
+		a.errorResponseJSON(w, r, http.StatusUnauthorized, "invalid or already used code, please log in again")
+		return
+	}
+
+	token, refreshToken, err := a.TokenModel.NewSession(user.ID, a.config.tokens.accessTTL, a.config.tokens.refreshTTL, clientIP(r), truncate(r.UserAgent(), 512))
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+	err = a.issueAccessToken(user, token)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	response := envelope{
+		"authentication_token": token,
+		"refresh_token":        refreshToken,
+	}
+	if incomingData.RecoveryCode != "" {
+		remaining, err := a.TwoFactorModel.RemainingRecoveryCodes(user.ID)
+		if err != nil {
+			a.serverErrorResponse(w, r, err)
+			return
+		}
+		response["recovery_codes_remaining"] = remaining
+	}
+
+	err = a.writeJSON(w, http.StatusCreated, response, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// ------------------------------------------------------------------------------------------------------------------------------
+func (a *applicationDependencies) showTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	user := a.contextGetUser(r)
+
+	twoFactor, err := a.TwoFactorModel.Get(user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			twoFactor = nil
+		default:
+			a.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	enabled := twoFactor != nil && twoFactor.EnabledAt != nil
+	status := envelope{"enabled": enabled}
+	if enabled {
+		status["enabled_at"] = twoFactor.EnabledAt
+		remaining, err := a.TwoFactorModel.RemainingRecoveryCodes(user.ID)
+		if err != nil {
+			a.serverErrorResponse(w, r, err)
+			return
+		}
+		status["recovery_codes_remaining"] = remaining
+	}
+
+	err = a.writeJSON(w, http.StatusOK, envelope{"two_factor": status}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// ------------------------------------------------------------------------------------------------------------------------------
+// enrollTwoFactorHandler starts enrollment with a new secret. 2FA is only turned on once the user confirms a code
+// from their authenticator with enableTwoFactorHandler.
+func (a *applicationDependencies) enrollTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	var incomingData struct {
+		Password string `json:"password"`
+	}
+	err := a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(incomingData.Password != "", "password", "must be provided")
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := a.currentUser(r)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+	match, err := user.Password.Matches(incomingData.Password)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+	if !match {
+		a.invalidCredentialsResponse(w, r)
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+	err = a.TwoFactorModel.StartEnrollment(user.ID, secret)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrTwoFactorEnabled):
+			a.errorResponseJSON(w, r, http.StatusConflict, err.Error())
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = a.writeJSON(w, http.StatusCreated, envelope{
+		"secret":      secret,
+		"otpauth_uri": totp.URI(twoFactorIssuer, user.Email, secret),
+	}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// ------------------------------------------------------------------------------------------------------------------------------
+func (a *applicationDependencies) enableTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	var incomingData struct {
+		Code string `json:"code"`
+	}
+	err := a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(incomingData.Code != "", "code", "must be provided")
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := a.contextGetUser(r)
+	twoFactor, err := a.TwoFactorModel.Get(user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.errorResponseJSON(w, r, http.StatusConflict, "start two-factor enrollment first")
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if twoFactor.EnabledAt != nil {
+		a.errorResponseJSON(w, r, http.StatusConflict, data.ErrTwoFactorEnabled.Error())
+		return
+	}
+
+	step, ok := totp.Validate(twoFactor.Secret, incomingData.Code, time.Now())
+	if !ok {
+		v.AddError("code", "is not valid, check the clock of the device running the authenticator")
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	recoveryCodes, err := a.TwoFactorModel.Enable(user.ID, step)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.editConflictResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// The recovery codes are only stored hashed, this is the only time they are shown
+	err = a.writeJSON(w, http.StatusOK, envelope{"recovery_codes": recoveryCodes}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// ------------------------------------------------------------------------------------------------------------------------------
+func (a *applicationDependencies) disableTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	var incomingData struct {
+		Password     string `json:"password"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	err := a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(incomingData.Password != "", "password", "must be provided")
+	validateSecondFactor(v, incomingData.Code, incomingData.RecoveryCode)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := a.currentUser(r)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+	match, err := user.Password.Matches(incomingData.Password)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+	if !match {
+		a.invalidCredentialsResponse(w, r)
+		return
+	}
+
+	enabled, err := a.TwoFactorModel.IsEnabled(user.ID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+	if enabled {
+		ok, err := a.checkSecondFactor(user.ID, incomingData.Code, incomingData.RecoveryCode)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrTwoFactorLocked):
+				a.twoFactorLockedResponse(w, r)
+			default:
+				a.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+		if !ok {
+			v.AddError("code", "is not valid or was already used")
+			a.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+	}
+
+	// Also clears an enrollment that was never confirmed
+	err = a.TwoFactorModel.Disable(user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = a.writeJSON(w, http.StatusOK, envelope{"message": "two-factor authentication was disabled"}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// ------------------------------------------------------------------------------------------------------------------------------
+func (a *applicationDependencies) regenerateRecoveryCodesHandler(w http.ResponseWriter, r *http.Request) {
+	var incomingData struct {
+		Code string `json:"code"`
+	}
+	err := a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(incomingData.Code != "", "code", "must be provided")
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := a.contextGetUser(r)
+	enabled, err := a.TwoFactorModel.IsEnabled(user.ID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+	if !enabled {
+		a.errorResponseJSON(w, r, http.StatusConflict, "two-factor authentication is not enabled")
+		return
+	}
+
+	ok, err := a.checkSecondFactor(user.ID, incomingData.Code, "")
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrTwoFactorLocked):
+			a.twoFactorLockedResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if !ok {
+		v.AddError("code", "is not valid or was already used")
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	recoveryCodes, err := a.TwoFactorModel.RegenerateRecoveryCodes(user.ID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = a.writeJSON(w, http.StatusOK, envelope{"recovery_codes": recoveryCodes}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
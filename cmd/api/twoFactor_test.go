@@ -0,0 +1,160 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/luigiacunaUB/cmps4191-test-3/internal/data"
+	"github.com/luigiacunaUB/cmps4191-test-3/internal/totp"
+)
+
+func TestTwoFactorLockout(t *testing.T) {
+	a, db := newTestApplication(t)
+
+	user := &data.User{Username: "two factor reader", Email: testEmail(t, db, "2fa-lockout"), Activated: true}
+	err := user.Password.Set("a password of the user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = a.UserModel.Insert(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = a.TwoFactorModel.StartEnrollment(user.ID, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := totp.Step(time.Now())
+	_, err = a.TwoFactorModel.Enable(user.ID, now-5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	codeAt := func(step int64) string {
+		code, err := totp.Code(secret, step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return code
+	}
+	// A code from outside the accepted steps is as wrong as a guess
+	wrongCode := codeAt(now - 10)
+
+	answer := func(code string) int {
+		challenge, err := a.TokenModel.New(user.ID, twoFactorChallengeTTL, data.ScopeTwoFactor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body := `{"challenge_token": "` + challenge.Plaintext + `", "code": "` + code + `"}`
+		w := httptest.NewRecorder()
+		a.createTwoFactorTokenHandler(w, httptest.NewRequest(http.MethodPost, "/v1/tokens/2fa", strings.NewReader(body)))
+		return w.Code
+	}
+
+	tests := []struct {
+		name string
+		code string
+		want int
+	}{
+		{"wrong 1", wrongCode, http.StatusUnauthorized},
+		{"wrong 2", wrongCode, http.StatusUnauthorized},
+		{"wrong 3", wrongCode, http.StatusUnauthorized},
+		{"wrong 4", wrongCode, http.StatusUnauthorized},
+		{"right code before the limit resets the count", codeAt(now), http.StatusCreated},
+		{"wrong 1 again", wrongCode, http.StatusUnauthorized},
+		{"wrong 2 again", wrongCode, http.StatusUnauthorized},
+		{"wrong 3 again", wrongCode, http.StatusUnauthorized},
+		{"wrong 4 again", wrongCode, http.StatusUnauthorized},
+		{"wrong 5 locks", wrongCode, http.StatusUnauthorized},
+		{"right code while locked", codeAt(now + 1), http.StatusTooManyRequests},
+	}
+	for _, tt := range tests {
+		got := answer(tt.code)
+		if got != tt.want {
+			t.Fatalf("%s: status %d, want %d", tt.name, got, tt.want)
+		}
+	}
+
+	twoFactor, err := a.TwoFactorModel.Get(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !twoFactor.Locked() || time.Until(*twoFactor.LockedUntil) > data.TwoFactorLockout+time.Minute {
+		t.Errorf("locked until %v, want about %v from now", twoFactor.LockedUntil, data.TwoFactorLockout)
+	}
+}
+
+func TestRequireTwoFactorSetting(t *testing.T) {
+	a, db := newTestApplication(t)
+
+	original, err := a.SettingsModel.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		current, err := a.SettingsModel.Get()
+		if err == nil {
+			current.RequireTwoFactorForWriters = original.RequireTwoFactorForWriters
+			err = a.SettingsModel.Update(current)
+		}
+		if err != nil {
+			t.Log(err)
+		}
+	})
+
+	user := &data.User{Username: "writer without 2fa", Email: testEmail(t, db, "2fa-setting"), Activated: true}
+	err = user.Password.Set("a password of the user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = a.UserModel.Insert(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	request := func(permissionCode string) int {
+		r := httptest.NewRequest(http.MethodPost, "/", nil)
+		r = a.contextSetUser(r, user)
+		r = a.contextSetPermissions(r, data.Permissions{"books:read", "books:write"})
+		w := httptest.NewRecorder()
+		a.requirePermission(permissionCode, ok)(w, r)
+		return w.Code
+	}
+	setRequired := func(required bool) {
+		settings, err := a.SettingsModel.Get()
+		if err != nil {
+			t.Fatal(err)
+		}
+		settings.RequireTwoFactorForWriters = required
+		err = a.SettingsModel.Update(settings)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		required   bool
+		permission string
+		want       int
+	}{
+		{"write route, not required", false, "books:write", http.StatusOK},
+		{"write route, required", true, "books:write", http.StatusForbidden},
+		{"read route, required", true, "books:read", http.StatusOK},
+	}
+	for _, tt := range tests {
+		setRequired(tt.required)
+		got := request(tt.permission)
+		if got != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
@@ -145,3 +145,322 @@ func (a *applicationDependencies) activateUserHandler(w http.ResponseWriter, r *
 		a.serverErrorResponse(w, r, err)
 	}
 }
+
+// ------------------------------------------------------------------------------------------------------------------------------
+func (a *applicationDependencies) updateUserPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var incomingData struct {
+		Password       string `json:"password"`
+		TokenPlaintext string `json:"token"`
+	}
+	err := a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	data.ValidatePasswordPlaintext(v, incomingData.Password)
+	data.ValidateTokenPlaintext(v, incomingData.TokenPlaintext)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := a.UserModel.GetForToken(data.ScopePasswordReset, incomingData.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired password reset token")
+			a.failedValidationResponse(w, r, v.Errors)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = user.Password.Set(incomingData.Password)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = a.UserModel.Update(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			a.editConflictResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// The reset token is used up, and anyone still logged in with the old password is logged out
+	err = a.TokenModel.DeleteAllForUser(data.ScopePasswordReset, user.ID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+	err = a.TokenModel.DeleteSessionsForUser(user.ID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+	a.sessionsRevoked()
+
+	data := envelope{
+		"message": "your password was successfully reset",
+	}
+
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// ------------------------------------------------------------------------------------------------------------------------------
+func (a *applicationDependencies) showCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := a.currentUser(r)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = a.writeJSON(w, http.StatusOK, envelope{"user": user}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// ------------------------------------------------------------------------------------------------------------------------------
+func (a *applicationDependencies) updateCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := a.currentUser(r)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Anything left out keeps its current value. A new email address is only used once it
+	// has been confirmed through the token sent to it.
+	var incomingData struct {
+		Username          *string `json:"username"`
+		Email             *string `json:"email"`
+		ReviewsPrivate    *bool   `json:"reviews_private"`
+		NotifyListUpdates *bool   `json:"notify_list_updates"`
+		Version           *int    `json:"version"`
+	}
+	err = a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	// Clients that send the version they last saw get an edit conflict if the account changed since
+	if incomingData.Version != nil && *incomingData.Version != user.Version {
+		a.editConflictResponse(w, r)
+		return
+	}
+
+	if incomingData.Username != nil {
+		user.Username = *incomingData.Username
+	}
+	if incomingData.ReviewsPrivate != nil {
+		user.ReviewsPrivate = *incomingData.ReviewsPrivate
+	}
+	if incomingData.NotifyListUpdates != nil {
+		user.NotifyListUpdates = *incomingData.NotifyListUpdates
+	}
+
+	v := validator.New()
+	data.ValidateUser(v, user)
+	changingEmail := incomingData.Email != nil && *incomingData.Email != user.Email
+	if changingEmail {
+		data.ValidateEmail(v, *incomingData.Email)
+	}
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Whether another account already uses the new address isn't checked here, answering differently
+	// would tell anyone which addresses are registered. A taken address fails when it is confirmed.
+	if changingEmail {
+		user.PendingEmail = incomingData.Email
+	}
+
+	err = a.UserModel.Update(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			a.editConflictResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if changingEmail {
+		// Only the token for the newest address works
+		err = a.TokenModel.DeleteAllForUser(data.ScopeEmailChange, user.ID)
+		if err != nil {
+			a.serverErrorResponse(w, r, err)
+			return
+		}
+		token, err := a.TokenModel.New(user.ID, 24*time.Hour, data.ScopeEmailChange)
+		if err != nil {
+			a.serverErrorResponse(w, r, err)
+			return
+		}
+
+		a.background(func() {
+			data := map[string]any{
+				"username":         user.Username,
+				"emailChangeToken": token.Plaintext,
+			}
+			err := a.mailer.Send(*user.PendingEmail, "token_email_change.tmpl", data)
+			if err != nil {
+				a.logger.Error(err.Error())
+			}
+		})
+	}
+
+	err = a.writeJSON(w, http.StatusOK, envelope{"user": user}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// ------------------------------------------------------------------------------------------------------------------------------
+func (a *applicationDependencies) changeCurrentUserPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := a.currentUser(r)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	var incomingData struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+	err = a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(incomingData.CurrentPassword != "", "current_password", "must be provided")
+	data.ValidatePasswordPlaintext(v, incomingData.NewPassword)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	match, err := user.Password.Matches(incomingData.CurrentPassword)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+	if !match {
+		a.invalidCredentialsResponse(w, r)
+		return
+	}
+
+	err = user.Password.Set(incomingData.NewPassword)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = a.UserModel.Update(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			a.editConflictResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Every session was opened with the old password, so they all have to log in again
+	err = a.TokenModel.DeleteSessionsForUser(user.ID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+	a.sessionsRevoked()
+
+	data := envelope{
+		"message": "your password was successfully changed, please log in again",
+	}
+
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// ------------------------------------------------------------------------------------------------------------------------------
+func (a *applicationDependencies) confirmEmailChangeHandler(w http.ResponseWriter, r *http.Request) {
+	var incomingData struct {
+		TokenPlaintext string `json:"token"`
+	}
+	err := a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	data.ValidateTokenPlaintext(v, incomingData.TokenPlaintext)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := a.UserModel.GetForToken(data.ScopeEmailChange, incomingData.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired email change token")
+			a.failedValidationResponse(w, r, v.Errors)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if user.PendingEmail == nil {
+		v.AddError("token", "invalid or expired email change token")
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user.Email = *user.PendingEmail
+	user.PendingEmail = nil
+	err = a.UserModel.Update(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateEmail):
+			// Only the owner of the address gets this far, but the error still doesn't say why
+			v.AddError("email", "the email address could not be changed")
+			a.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrEditConflict):
+			a.editConflictResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = a.TokenModel.DeleteAllForUser(data.ScopeEmailChange, user.ID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = a.writeJSON(w, http.StatusOK, envelope{"user": user}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,97 @@
+package content
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Action is what a filter wants done with the text it matched
+type Action int
+
+const (
+	Allow Action = iota
+	Mask
+	Flag
+	Reject
+)
+
+func (a Action) String() string {
+	switch a {
+	case Mask:
+		return "mask"
+	case Flag:
+		return "flag"
+	case Reject:
+		return "reject"
+	default:
+		return "allow"
+	}
+}
+
+// ParseAction turns a configuration value into an Action, "off" disables the filter
+func ParseAction(value string) (Action, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "off", "allow", "":
+		return Allow, nil
+	case "mask":
+		return Mask, nil
+	case "flag":
+		return Flag, nil
+	case "reject":
+		return Reject, nil
+	}
+	return Allow, fmt.Errorf("unknown content filter action %q", value)
+}
+
+// Verdict is the outcome of a single filter, Text holds the masked text when Action is Mask
+type Verdict struct {
+	Action Action
+	Text   string
+	Reason string
+}
+
+// Filter checks a piece of user submitted text
+type Filter interface {
+	Check(text string) Verdict
+}
+
+// Result is the combined outcome of every filter in a pipeline
+type Result struct {
+	Text     string
+	Rejected bool
+	Flagged  bool
+	Reasons  []string
+}
+
+// Pipeline runs text through its filters in order, masks are applied before the next filter runs
+type Pipeline struct {
+	filters []Filter
+}
+
+func NewPipeline(filters ...Filter) *Pipeline {
+	return &Pipeline{filters: filters}
+}
+
+// --------------------------------------------------------------------------------------------------------------------
+func (p *Pipeline) Run(text string) Result {
+	result := Result{Text: text}
+	if p == nil {
+		return result
+	}
+
+	for _, filter := range p.filters {
+		verdict := filter.Check(result.Text)
+		switch verdict.Action {
+		case Mask:
+			result.Text = verdict.Text
+		case Flag:
+			result.Flagged = true
+			result.Reasons = append(result.Reasons, verdict.Reason)
+		case Reject:
+			result.Rejected = true
+			result.Reasons = append(result.Reasons, verdict.Reason)
+		}
+	}
+
+	return result
+}
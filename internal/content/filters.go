@@ -0,0 +1,150 @@
+package content
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// --------------------------------------------------------------------------------------------------------------------
+// BannedWords matches whole words from a configured list, ignoring case. Word boundaries are checked on
+// Unicode letters because \b in go's regexp only knows ASCII, so "bad" would match inside "badé".
+type BannedWords struct {
+	action Action
+	rx     *regexp.Regexp
+}
+
+func NewBannedWords(words []string, action Action) *BannedWords {
+	var quoted []string
+	for _, word := range words {
+		word = strings.TrimSpace(word)
+		if word != "" {
+			quoted = append(quoted, regexp.QuoteMeta(word))
+		}
+	}
+
+	// The longest word wins when one banned word starts another
+	sort.Slice(quoted, func(i, j int) bool { return len(quoted[i]) > len(quoted[j]) })
+
+	filter := &BannedWords{action: action}
+	if len(quoted) > 0 {
+		filter.rx = regexp.MustCompile(`(?i)(?:` + strings.Join(quoted, "|") + `)`)
+	}
+	return filter
+}
+
+func (b *BannedWords) Check(text string) Verdict {
+	if b.rx == nil || b.action == Allow {
+		return Verdict{Action: Allow, Text: text}
+	}
+
+	var masked strings.Builder
+	found := false
+	last := 0
+	for _, match := range b.rx.FindAllStringIndex(text, -1) {
+		start, end := match[0], match[1]
+		if !wordBoundary(text, start, end) {
+			continue
+		}
+		found = true
+		masked.WriteString(text[last:start])
+		masked.WriteString(strings.Repeat("*", utf8.RuneCountInString(text[start:end])))
+		last = end
+	}
+
+	if !found {
+		return Verdict{Action: Allow, Text: text}
+	}
+	masked.WriteString(text[last:])
+	return Verdict{Action: b.action, Text: masked.String(), Reason: "contains banned words"}
+}
+
+// wordBoundary reports whether text[start:end] is a whole word, not part of a longer one
+func wordBoundary(text string, start, end int) bool {
+	if before, _ := utf8.DecodeLastRuneInString(text[:start]); start > 0 && isWordChar(before) {
+		return false
+	}
+	if after, _ := utf8.DecodeRuneInString(text[end:]); end < len(text) && isWordChar(after) {
+		return false
+	}
+	return true
+}
+
+func isWordChar(char rune) bool {
+	return unicode.IsLetter(char) || unicode.IsDigit(char) || unicode.IsMark(char) || char == '_'
+}
+
+// --------------------------------------------------------------------------------------------------------------------
+// Links treats text with more than MaxLinks links as spam
+type Links struct {
+	MaxLinks int
+	action   Action
+}
+
+var linkRX = regexp.MustCompile(`(?i)\b(?:https?://|www\.)[^\s<>()]+`)
+
+func NewLinks(maxLinks int, action Action) *Links {
+	return &Links{MaxLinks: maxLinks, action: action}
+}
+
+func (l *Links) Check(text string) Verdict {
+	if l.action == Allow {
+		return Verdict{Action: Allow, Text: text}
+	}
+
+	links := linkRX.FindAllString(text, -1)
+	if len(links) <= l.MaxLinks {
+		return Verdict{Action: Allow, Text: text}
+	}
+
+	masked := linkRX.ReplaceAllString(text, "[link removed]")
+	return Verdict{Action: l.action, Text: masked, Reason: fmt.Sprintf("contains more than %d links", l.MaxLinks)}
+}
+
+// --------------------------------------------------------------------------------------------------------------------
+// RepeatedCharacters catches runs like "!!!!!!!!" or "sooooooo" longer than MaxRun. Whitespace and Markdown
+// punctuation are ignored, so rules like "----------", setext "=====" headings and table rows pass.
+type RepeatedCharacters struct {
+	MaxRun int
+	action Action
+}
+
+// markdownPunctuation are the characters Markdown syntax repeats on purpose
+const markdownPunctuation = "-=*_~`#|:"
+
+func NewRepeatedCharacters(maxRun int, action Action) *RepeatedCharacters {
+	return &RepeatedCharacters{MaxRun: maxRun, action: action}
+}
+
+func (rc *RepeatedCharacters) Check(text string) Verdict {
+	if rc.action == Allow || rc.MaxRun < 1 {
+		return Verdict{Action: Allow, Text: text}
+	}
+
+	// go's regexp has no back references, so the runs are found by hand
+	var masked strings.Builder
+	found := false
+	var previous rune
+	run := 0
+	for _, char := range text {
+		if char == previous && !unicode.IsSpace(char) && !strings.ContainsRune(markdownPunctuation, char) {
+			run++
+		} else {
+			previous = char
+			run = 1
+		}
+		if run > rc.MaxRun {
+			found = true
+			continue
+		}
+		masked.WriteRune(char)
+	}
+
+	if !found {
+		return Verdict{Action: Allow, Text: text}
+	}
+	return Verdict{Action: rc.action, Text: masked.String(), Reason: fmt.Sprintf("repeats a character more than %d times", rc.MaxRun)}
+}
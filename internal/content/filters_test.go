@@ -0,0 +1,148 @@
+package content
+
+import "testing"
+
+func TestBannedWords(t *testing.T) {
+	filter := NewBannedWords([]string{"darn", "heck", " darnit "}, Mask)
+
+	tests := []struct {
+		name   string
+		text   string
+		action Action
+		masked string
+	}{
+		{"clean", "a lovely book", Allow, "a lovely book"},
+		{"whole word", "darn this book", Mask, "**** this book"},
+		{"ignores case", "DARN it", Mask, "**** it"},
+		{"longest word wins", "darnit all", Mask, "****** all"},
+		{"inside ascii word", "darned", Allow, "darned"},
+		{"inside unicode word", "darné and éheck", Allow, "darné and éheck"},
+		{"next to punctuation", "(heck!)", Mask, "(****!)"},
+		{"several", "heck heck", Mask, "**** ****"},
+		{"unicode neighbours masked correctly", "¡heck¡", Mask, "¡****¡"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verdict := filter.Check(tt.text)
+			if verdict.Action != tt.action {
+				t.Fatalf("action = %v, want %v", verdict.Action, tt.action)
+			}
+			if verdict.Text != tt.masked {
+				t.Errorf("text = %q, want %q", verdict.Text, tt.masked)
+			}
+		})
+	}
+}
+
+func TestBannedWordsEmptyList(t *testing.T) {
+	verdict := NewBannedWords([]string{"", "  "}, Reject).Check("anything")
+	if verdict.Action != Allow {
+		t.Errorf("action = %v, want allow", verdict.Action)
+	}
+}
+
+func TestLinks(t *testing.T) {
+	filter := NewLinks(1, Mask)
+
+	tests := []struct {
+		name   string
+		text   string
+		action Action
+		masked string
+	}{
+		{"none", "no links here", Allow, "no links here"},
+		{"at the limit", "see https://example.com", Allow, "see https://example.com"},
+		{"over the limit", "http://a.com and www.b.com", Mask, "[link removed] and [link removed]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verdict := filter.Check(tt.text)
+			if verdict.Action != tt.action {
+				t.Fatalf("action = %v, want %v", verdict.Action, tt.action)
+			}
+			if verdict.Text != tt.masked {
+				t.Errorf("text = %q, want %q", verdict.Text, tt.masked)
+			}
+		})
+	}
+}
+
+func TestRepeatedCharacters(t *testing.T) {
+	filter := NewRepeatedCharacters(3, Mask)
+
+	tests := []struct {
+		name   string
+		text   string
+		action Action
+		masked string
+	}{
+		{"short run", "sooo good", Allow, "sooo good"},
+		{"long run", "soooooo good", Mask, "sooo good"},
+		{"exclamation marks", "wow!!!!!!", Mask, "wow!!!"},
+		{"whitespace", "a      b", Allow, "a      b"},
+		{"horizontal rule", "----------", Allow, "----------"},
+		{"setext heading", "Title\n=====", Allow, "Title\n====="},
+		{"table separator", "|:-----|------:|", Allow, "|:-----|------:|"},
+		{"unicode", "ééééé", Mask, "ééé"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verdict := filter.Check(tt.text)
+			if verdict.Action != tt.action {
+				t.Fatalf("action = %v, want %v", verdict.Action, tt.action)
+			}
+			if verdict.Text != tt.masked {
+				t.Errorf("text = %q, want %q", verdict.Text, tt.masked)
+			}
+		})
+	}
+}
+
+func TestParseAction(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    Action
+		wantErr bool
+	}{
+		{"off", Allow, false},
+		{"", Allow, false},
+		{" Mask ", Mask, false},
+		{"flag", Flag, false},
+		{"REJECT", Reject, false},
+		{"delete", Allow, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseAction(tt.value)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseAction(%q) = %v, %v", tt.value, got, err)
+		}
+	}
+}
+
+func TestPipeline(t *testing.T) {
+	pipeline := NewPipeline(
+		NewRepeatedCharacters(3, Flag),
+		NewLinks(0, Reject),
+		NewBannedWords([]string{"heck"}, Mask),
+	)
+
+	result := pipeline.Run("heck!!!!!! www.example.com")
+	if !result.Flagged || !result.Rejected {
+		t.Errorf("flagged = %v, rejected = %v, want both", result.Flagged, result.Rejected)
+	}
+	if result.Text != "****!!!!!! www.example.com" {
+		t.Errorf("text = %q", result.Text)
+	}
+	if len(result.Reasons) != 2 {
+		t.Errorf("reasons = %v, want 2", result.Reasons)
+	}
+
+	var nilPipeline *Pipeline
+	if got := nilPipeline.Run("text"); got.Text != "text" || got.Flagged || got.Rejected {
+		t.Errorf("nil pipeline changed the text: %+v", got)
+	}
+}
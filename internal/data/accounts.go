@@ -0,0 +1,142 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"fmt"
+	"time"
+)
+
+// AnonymousUsername replaces the username of an anonymized account, its kept reviews are shown under it
+const AnonymousUsername = "deleted user"
+
+// --------------------------------------------------------------------------------------------------------------------------------------
+// DeleteAccount removes the user and everything that belongs to them. When keepReviews is set their reviews
+// stay up without an author, otherwise they are deleted with the account.
+func (u UserModel) DeleteAccount(userID int64, keepReviews bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := u.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if !keepReviews {
+		err = deleteReviewsForUser(ctx, tx, userID)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Tokens, permissions, reading lists, goals and so on go with the user through ON DELETE CASCADE,
+	// the reviews that are left keep their place with user_id set to NULL
+	result, err := tx.ExecContext(ctx, `DELETE FROM users WHERE id = $1`, userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return tx.Commit()
+}
+
+// --------------------------------------------------------------------------------------------------------------------------------------
+// AnonymizeAccount keeps the user row but strips everything that identifies the person: the username and email
+// are replaced, the password is set to a random one nobody knows, and their tokens, permissions, reading lists,
+// shares, follows, goals, API keys, linked provider accounts and 2FA secrets are removed. When keepReviews is set their reviews stay up under AnonymousUsername.
+func (u UserModel) AnonymizeAccount(userID int64, keepReviews bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	plaintext, err := randomPassword()
+	if err != nil {
+		return err
+	}
+	var pw password
+	err = pw.Set(plaintext)
+	if err != nil {
+		return err
+	}
+
+	tx, err := u.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// The email column is unique, so each anonymized account gets its own unroutable address
+	query := `
+		UPDATE users
+		SET username = $1, email = 'deleted-' || id || '@deleted.invalid', password_hash = $2,
+		    activated = false, reviews_private = false, notify_list_updates = false,
+		    pending_email = NULL, version = version + 1
+		WHERE id = $3
+	`
+	result, err := tx.ExecContext(ctx, query, AnonymousUsername, pw.hash, userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	if !keepReviews {
+		err = deleteReviewsForUser(ctx, tx, userID)
+		if err != nil {
+			return err
+		}
+	}
+
+	personalData := []string{
+		`DELETE FROM tokens WHERE user_id = $1`,
+		`DELETE FROM users_permissions WHERE user_id = $1`,
+		`DELETE FROM reading_lists WHERE created_by = $1`,
+		`DELETE FROM reading_list_collaborators WHERE user_id = $1`,
+		`DELETE FROM reading_list_followers WHERE user_id = $1`,
+		`DELETE FROM reading_goals WHERE user_id = $1`,
+		`DELETE FROM api_keys WHERE user_id = $1`,
+		`DELETE FROM user_identities WHERE user_id = $1`,
+		`DELETE FROM totp_recovery_codes WHERE user_id = $1`,
+		`DELETE FROM user_totp WHERE user_id = $1`,
+	}
+	for _, query := range personalData {
+		_, err = tx.ExecContext(ctx, query, userID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// deleteReviewsForUser removes the user's reviews, their revisions go with them through ON DELETE CASCADE
+func deleteReviewsForUser(ctx context.Context, tx *sql.Tx, userID int64) error {
+	_, err := tx.ExecContext(ctx, `DELETE FROM reviews WHERE user_id = $1`, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete reviews: %w", err)
+	}
+	return nil
+}
+
+// randomPassword returns a password nobody knows, so an anonymized account can never be logged in to
+func randomPassword() (string, error) {
+	randomBytes := make([]byte, 32)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return "", err
+	}
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes), nil
+}
@@ -0,0 +1,237 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/luigiacunaUB/cmps4191-test-3/internal/validator"
+)
+
+// APIKeyPrefix starts every API key so they are easy to recognise, in logs and in secret scanners
+const APIKeyPrefix = "bk_"
+
+// apiKeyShownLength is how much of a key is kept in plain text to tell keys apart
+const apiKeyShownLength = len(APIKeyPrefix) + 6
+
+// apiKeyTouchInterval is how stale last_used_at may get before a request updates it
+const apiKeyTouchInterval = time.Minute
+
+type APIKeyModel struct {
+	DB *sql.DB
+}
+
+// APIKey is a long-lived credential limited to some of its owner's permissions. Plaintext is only
+// filled in when the key is created, it is not stored.
+type APIKey struct {
+	ID          int64       `json:"id"`
+	UserID      int64       `json:"-"`
+	Name        string      `json:"name"`
+	Plaintext   string      `json:"key,omitempty"`
+	Prefix      string      `json:"prefix"`
+	Hash        []byte      `json:"-"`
+	Permissions Permissions `json:"permissions"`
+	CreatedAt   time.Time   `json:"created_at"`
+	ExpiresAt   *time.Time  `json:"expires_at"`
+	LastUsedAt  *time.Time  `json:"last_used_at"`
+}
+
+// --------------------------------------------------------------------------------------------------------------------------------------
+// ValidateAPIKey checks the key's name, expiry and that it only asks for permissions the owner has
+func ValidateAPIKey(v *validator.Validator, key *APIKey, ownerPermissions Permissions) {
+	v.Check(strings.TrimSpace(key.Name) != "", "name", "must be provided")
+	v.Check(len(key.Name) <= 100, "name", "must not be more than 100 bytes long")
+
+	v.Check(len(key.Permissions) > 0, "permissions", "must contain at least one permission")
+	seen := make(map[string]bool)
+	for _, code := range key.Permissions {
+		if seen[code] {
+			v.AddError("permissions", "must not contain duplicate values")
+			break
+		}
+		seen[code] = true
+		if !ownerPermissions.Include(code) {
+			v.AddError("permissions", "can only contain permissions you have, "+code+" is not one of them")
+			break
+		}
+	}
+
+	if key.ExpiresAt != nil {
+		v.Check(key.ExpiresAt.After(time.Now()), "expires_at", "must be in the future")
+	}
+}
+
+// --------------------------------------------------------------------------------------------------------------------------------------
+// Insert generates the key, stores its hash and fills in key.Plaintext for the one time it is shown
+func (m APIKeyModel) Insert(key *APIKey) error {
+	randomBytes := make([]byte, 32)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return err
+	}
+	key.Plaintext = APIKeyPrefix + base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes)
+	key.Prefix = key.Plaintext[:apiKeyShownLength]
+	hash := sha256.Sum256([]byte(key.Plaintext))
+	key.Hash = hash[:]
+
+	query := `
+		INSERT INTO api_keys (user_id, name, prefix, hash, permissions, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at
+	`
+	args := []any{key.UserID, key.Name, key.Prefix, key.Hash, pq.Array([]string(key.Permissions)), key.ExpiresAt}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&key.ID, &key.CreatedAt)
+}
+
+// --------------------------------------------------------------------------------------------------------------------------------------
+func (m APIKeyModel) GetAllForUser(userID int64) ([]APIKey, error) {
+	query := `
+		SELECT id, user_id, name, prefix, permissions, created_at, expires_at, last_used_at
+		FROM api_keys
+		WHERE user_id = $1
+		ORDER BY id
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []APIKey{}
+	for rows.Next() {
+		var key APIKey
+		err := rows.Scan(
+			&key.ID,
+			&key.UserID,
+			&key.Name,
+			&key.Prefix,
+			pq.Array((*[]string)(&key.Permissions)),
+			&key.CreatedAt,
+			&key.ExpiresAt,
+			&key.LastUsedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// --------------------------------------------------------------------------------------------------------------------------------------
+// Delete revokes one of the user's keys, another user's key is reported as not found
+func (m APIKeyModel) Delete(id, userID int64) error {
+	query := `
+		DELETE FROM api_keys
+		WHERE id = $1 AND user_id = $2
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// --------------------------------------------------------------------------------------------------------------------------------------
+// GetForKey looks up the owner of an unexpired key. The key's permissions are narrowed to the ones the owner
+// still has, so taking a permission away from a user also takes it away from their keys.
+func (m APIKeyModel) GetForKey(keyPlaintext string) (*User, *APIKey, error) {
+	if !strings.HasPrefix(keyPlaintext, APIKeyPrefix) {
+		return nil, nil, ErrRecordNotFound
+	}
+	keyHash := sha256.Sum256([]byte(keyPlaintext))
+
+	query := `
+		SELECT users.id, users.created_at, users.username,
+		       users.email, users.password_hash, users.activated, users.version,
+		       users.reviews_private, users.notify_list_updates, users.pending_email,
+		       k.id, k.name, k.prefix, k.created_at, k.expires_at, k.last_used_at,
+		       ARRAY(
+		           SELECT p.code
+		           FROM users_permissions up
+		           INNER JOIN permissions p ON p.id = up.permission_id
+		           WHERE up.user_id = k.user_id AND p.code = ANY(k.permissions)
+		       )
+		FROM api_keys k
+		INNER JOIN users ON users.id = k.user_id
+		WHERE k.hash = $1
+		AND (k.expires_at IS NULL OR k.expires_at > $2)
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var user User
+	var key APIKey
+	err := m.DB.QueryRowContext(ctx, query, keyHash[:], time.Now()).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Username,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.Version,
+		&user.ReviewsPrivate,
+		&user.NotifyListUpdates,
+		&user.PendingEmail,
+		&key.ID,
+		&key.Name,
+		&key.Prefix,
+		&key.CreatedAt,
+		&key.ExpiresAt,
+		&key.LastUsedAt,
+		pq.Array((*[]string)(&key.Permissions)),
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, nil, ErrRecordNotFound
+		default:
+			return nil, nil, err
+		}
+	}
+	key.UserID = user.ID
+
+	return &user, &key, nil
+}
+
+// --------------------------------------------------------------------------------------------------------------------------------------
+// Touch records that the key was just used, keys used within the last apiKeyTouchInterval are left alone
+func (m APIKeyModel) Touch(key *APIKey) error {
+	now := time.Now()
+	if key.LastUsedAt != nil && now.Sub(*key.LastUsedAt) < apiKeyTouchInterval {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `UPDATE api_keys SET last_used_at = $1 WHERE id = $2`, now, key.ID)
+	return err
+}
@@ -1,6 +1,7 @@
 package data
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
@@ -149,9 +150,9 @@ func (b BookModel) SearchDatabase(title string, author string, genre string) ([]
 	formattedAuthor := formatQuery(author)
 	formattedGenre := formatQuery(genre)
 
-	logger.Info("Formatted Title: ", formattedTitle)
-	logger.Info("Formatted Author: ", formattedAuthor)
-	logger.Info("Formatted Genre: ", formattedGenre)
+	logger.Info("Formatted Title", "title", formattedTitle)
+	logger.Info("Formatted Author", "author", formattedAuthor)
+	logger.Info("Formatted Genre", "genre", formattedGenre)
 	//using queries search to find ids
 	query := `SELECT b.id
 	 	FROM books b
@@ -295,6 +296,106 @@ func (b BookModel) GetBook(id int64) (Book, error) {
 
 }
 
+// ----------------------------------------------------------------------------------------------------------------------------------------------
+// GetBooksByIDs loads every book in ids with one query, keyed by book id. IDs with no book are left out.
+func (b BookModel) GetBooksByIDs(ids []int64) (map[int64]Book, error) {
+	books := make(map[int64]Book, len(ids))
+	if len(ids) == 0 {
+		return books, nil
+	}
+
+	query := `SELECT b.id, b.title, ARRAY_REMOVE(ARRAY_AGG(a.name), NULL) AS authors, b.isbn, b.publication_date, b.genre, b.description, b.average_rating
+	FROM books b
+	LEFT JOIN book_authors ba ON b.id = ba.book_id
+	LEFT JOIN authors a ON ba.author_id = a.id
+	WHERE b.id = ANY($1)
+	GROUP BY b.id, b.title, b.isbn, b.publication_date, b.genre, b.description, b.average_rating`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := b.DB.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var book Book
+		var authors []string
+		err := rows.Scan(
+			&book.ID,
+			&book.Title,
+			pq.Array(&authors),
+			&book.ISBN,
+			&book.PublicationDate,
+			&book.Genre,
+			&book.Description,
+			&book.AverageRating,
+		)
+		if err != nil {
+			return nil, err
+		}
+		book.Authors = authors
+		books[book.ID] = book
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return books, nil
+}
+
+// ----------------------------------------------------------------------------------------------------------------------------------------------
+// FindBookID looks a book up by any of its ISBNs and, failing that, by title and author. Hyphens and spaces in
+// ISBNs and the case of titles and authors are ignored.
+func (b BookModel) FindBookID(isbns []string, titles []string, author string) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var id int64
+	if len(isbns) > 0 {
+		query := `
+			SELECT id FROM books
+			WHERE REGEXP_REPLACE(UPPER(isbn), '[^0-9X]', '', 'g') = ANY($1)
+			ORDER BY id
+			LIMIT 1`
+		err := b.DB.QueryRowContext(ctx, query, pq.Array(isbns)).Scan(&id)
+		if err == nil {
+			return id, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return 0, err
+		}
+	}
+
+	if len(titles) == 0 || author == "" {
+		return 0, ErrRecordNotFound
+	}
+	lowered := make([]string, len(titles))
+	for i, title := range titles {
+		lowered[i] = strings.ToLower(title)
+	}
+	query := `
+		SELECT b.id FROM books b
+		WHERE LOWER(b.title) = ANY($1)
+		AND EXISTS (
+			SELECT 1 FROM book_authors ba
+			INNER JOIN authors a ON a.id = ba.author_id
+			WHERE ba.book_id = b.id AND LOWER(a.name) = LOWER($2)
+		)
+		ORDER BY b.id
+		LIMIT 1`
+	err := b.DB.QueryRowContext(ctx, query, pq.Array(lowered), author).Scan(&id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrRecordNotFound
+		}
+		return 0, err
+	}
+	return id, nil
+}
+
 // ----------------------------------------------------------------------------------------------------------------------------------------------
 func (b BookModel) UpdateBook(book Book) error {
 	// Start a transaction to ensure both the book and its authors are updated atomically.
@@ -489,3 +590,99 @@ func (b BookModel) SearchBookByID(id int64) (bool, error) {
 	// Book exists
 	return true, nil
 }
+
+// RatingPrior is the prior used for the Bayesian rating, a Mean of 0 uses the mean of every review in the window
+type RatingPrior struct {
+	Mean   float64
+	Weight float64
+}
+
+// RankedBook is a book on a leaderboard with the numbers it was ranked by
+type RankedBook struct {
+	Book
+	ReviewCount   int64   `json:"review_count"`
+	PeriodAverage float64 `json:"period_average"`
+	Score         float64 `json:"score"`
+}
+
+// ------------------------------------------------------------------------------------------------------------------------------------------
+// GetTopRated ranks books by (n*avg + m*C) / (n + m), where n and avg come from the reviews written in [from, to)
+// and C and m are the prior mean and weight. A nil from or to leaves that side of the window open.
+func (b BookModel) GetTopRated(genre string, from, to *time.Time, prior RatingPrior, filters Filters) ([]RankedBook, MetaData, error) {
+	query := fmt.Sprintf(`
+		WITH window_reviews AS (
+			SELECT book_id, rating
+			FROM reviews
+			WHERE ($1::timestamp IS NULL OR review_date >= $1)
+			AND ($2::timestamp IS NULL OR review_date < $2)
+		),
+		prior AS (
+			SELECT COALESCE($3::numeric, AVG(rating), 0) AS mean
+			FROM window_reviews
+		),
+		stats AS (
+			SELECT book_id, COUNT(*) AS review_count, AVG(rating) AS average
+			FROM window_reviews
+			GROUP BY book_id
+		)
+		SELECT COUNT(*) OVER(), b.id, b.title, ARRAY_REMOVE(ARRAY_AGG(a.name), NULL) AS authors,
+		       b.isbn, b.publication_date, b.genre, b.description, b.average_rating,
+		       s.review_count, s.average,
+		       (s.review_count * s.average + $4::numeric * p.mean) / (s.review_count + $4::numeric) AS score
+		FROM stats s
+		INNER JOIN books b ON b.id = s.book_id
+		CROSS JOIN prior p
+		LEFT JOIN book_authors ba ON b.id = ba.book_id
+		LEFT JOIN authors a ON ba.author_id = a.id
+		WHERE ($5 = '' OR LOWER(b.genre) = LOWER($5))
+		GROUP BY b.id, s.review_count, s.average, p.mean
+		ORDER BY %s %s, b.id ASC
+		LIMIT $6 OFFSET $7`, filters.sortColumn(), filters.sortDirection())
+
+	// a zero mean means the prior comes from the reviews themselves
+	var priorMean *float64
+	if prior.Mean > 0 {
+		priorMean = &prior.Mean
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := b.DB.QueryContext(ctx, query, from, to, priorMean, prior.Weight, genre, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, MetaData{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	books := []RankedBook{}
+
+	for rows.Next() {
+		var book RankedBook
+		err := rows.Scan(
+			&totalRecords,
+			&book.ID,
+			&book.Title,
+			pq.Array(&book.Authors),
+			&book.ISBN,
+			&book.PublicationDate,
+			&book.Genre,
+			&book.Description,
+			&book.AverageRating,
+			&book.ReviewCount,
+			&book.PeriodAverage,
+			&book.Score,
+		)
+		if err != nil {
+			return nil, MetaData{}, err
+		}
+		books = append(books, book)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, MetaData{}, err
+	}
+
+	metadata := calculateMetaData(totalRecords, filters.Page, filters.PageSize)
+	return books, metadata, nil
+}
@@ -0,0 +1,113 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// kinds of content that can be flagged for moderation
+const (
+	ContentTypeReview      = "review"
+	ContentTypeReadingList = "reading_list"
+)
+
+type ContentFlagModel struct {
+	DB *sql.DB
+}
+
+type ContentFlag struct {
+	ID          int64     `json:"id"`
+	ContentType string    `json:"content_type"`
+	ContentID   int64     `json:"content_id"`
+	Reasons     []string  `json:"reasons"`
+	Resolved    bool      `json:"resolved"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// --------------------------------------------------------------------------------------------------------------------
+func (c ContentFlagModel) Insert(flag *ContentFlag) error {
+	query := `
+		INSERT INTO content_flags (content_type, content_id, reasons)
+		VALUES ($1, $2, $3)
+		RETURNING id, resolved, created_at
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return c.DB.QueryRowContext(ctx, query, flag.ContentType, flag.ContentID, pq.Array(flag.Reasons)).
+		Scan(&flag.ID, &flag.Resolved, &flag.CreatedAt)
+}
+
+// --------------------------------------------------------------------------------------------------------------------
+func (c ContentFlagModel) GetAllOpen(filters Filters) ([]ContentFlag, MetaData, error) {
+	query := fmt.Sprintf(`
+		SELECT COUNT(*) OVER(), id, content_type, content_id, reasons, resolved, created_at
+		FROM content_flags
+		WHERE NOT resolved
+		ORDER BY %s %s, id ASC
+		LIMIT $1 OFFSET $2
+	`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := c.DB.QueryContext(ctx, query, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, MetaData{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	flags := []ContentFlag{}
+	for rows.Next() {
+		var flag ContentFlag
+		err := rows.Scan(
+			&totalRecords,
+			&flag.ID,
+			&flag.ContentType,
+			&flag.ContentID,
+			pq.Array(&flag.Reasons),
+			&flag.Resolved,
+			&flag.CreatedAt,
+		)
+		if err != nil {
+			return nil, MetaData{}, err
+		}
+		flags = append(flags, flag)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, MetaData{}, err
+	}
+
+	metadata := calculateMetaData(totalRecords, filters.Page, filters.PageSize)
+	return flags, metadata, nil
+}
+
+// --------------------------------------------------------------------------------------------------------------------
+func (c ContentFlagModel) Resolve(id int64) error {
+	query := `
+		UPDATE content_flags
+		SET resolved = true
+		WHERE id = $1 AND NOT resolved
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := c.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
@@ -7,3 +7,8 @@ import (
 var ErrRecordNotFound = errors.New("record not found")
 var QueryFail = errors.New("error in SQL query")
 var ErrEditConflict = errors.New("edit conflict")
+var ErrReadingListOrder = errors.New("the order must name every book on the reading list exactly once")
+var ErrBulkIncomplete = errors.New("not every book could be changed, so none were")
+var ErrRefreshTokenReused = errors.New("refresh token has already been used")
+var ErrTwoFactorEnabled = errors.New("two-factor authentication is already enabled")
+var ErrTwoFactorLocked = errors.New("too many wrong codes, two-factor authentication is locked for a while")
@@ -16,8 +16,8 @@ type Filters struct {
 type MetaData struct {
 	CurrentPage  int `json:"current_page,omitempty"`
 	PageSize     int `json:"page_size,omitempty"`
-	FirstPage    int `json: "first_page,omitempty`
-	LastPage     int `json: "last_page,omitempty"`
+	FirstPage    int `json:"first_page,omitempty"`
+	LastPage     int `json:"last_page,omitempty"`
 	TotalRecords int `json:"total_records,omitempty"`
 }
 
@@ -0,0 +1,154 @@
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type IdentityModel struct {
+	DB *sql.DB
+}
+
+// Identity is an account at an external identity provider linked to a user
+type Identity struct {
+	Issuer      string    `json:"issuer"`
+	Subject     string    `json:"subject"`
+	UserID      int64     `json:"-"`
+	Email       string    `json:"email"`
+	CreatedAt   time.Time `json:"created_at"`
+	LastLoginAt time.Time `json:"last_login_at"`
+}
+
+// --------------------------------------------------------------------------------------------------------------------------------------
+// InsertLoginState keeps the PKCE verifier and nonce of a login until the provider redirects back with state
+func (m IdentityModel) InsertLoginState(state, codeVerifier, nonce string, ttl time.Duration) error {
+	stateHash := sha256.Sum256([]byte(state))
+	query := `
+		INSERT INTO oidc_login_states (state_hash, code_verifier, nonce, expiry)
+		VALUES ($1, $2, $3, $4)
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Logins that were never finished are cleared out on the way
+	_, err := m.DB.ExecContext(ctx, `DELETE FROM oidc_login_states WHERE expiry <= $1`, time.Now())
+	if err != nil {
+		return err
+	}
+
+	_, err = m.DB.ExecContext(ctx, query, stateHash[:], codeVerifier, nonce, time.Now().Add(ttl))
+	return err
+}
+
+// --------------------------------------------------------------------------------------------------------------------------------------
+// ConsumeLoginState returns the verifier and nonce saved for state and deletes them, so each state works once
+func (m IdentityModel) ConsumeLoginState(state string) (string, string, error) {
+	stateHash := sha256.Sum256([]byte(state))
+	query := `
+		DELETE FROM oidc_login_states
+		WHERE state_hash = $1
+		RETURNING code_verifier, nonce, expiry
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var codeVerifier, nonce string
+	var expiry time.Time
+	err := m.DB.QueryRowContext(ctx, query, stateHash[:]).Scan(&codeVerifier, &nonce, &expiry)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return "", "", ErrRecordNotFound
+		default:
+			return "", "", err
+		}
+	}
+	if !expiry.After(time.Now()) {
+		return "", "", ErrRecordNotFound
+	}
+
+	return codeVerifier, nonce, nil
+}
+
+// --------------------------------------------------------------------------------------------------------------------------------------
+// GetUserID returns the user linked to the provider account and records the login
+func (m IdentityModel) GetUserID(issuer, subject, email string) (int64, error) {
+	query := `
+		UPDATE user_identities
+		SET last_login_at = NOW(), email = COALESCE(NULLIF($3, ''), email)
+		WHERE issuer = $1 AND subject = $2
+		RETURNING user_id
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var userID int64
+	err := m.DB.QueryRowContext(ctx, query, issuer, subject, email).Scan(&userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, ErrRecordNotFound
+		default:
+			return 0, err
+		}
+	}
+	return userID, nil
+}
+
+// --------------------------------------------------------------------------------------------------------------------------------------
+// Link connects the provider account to the user, a provider account already linked keeps its user
+func (m IdentityModel) Link(userID int64, issuer, subject, email string) error {
+	query := `
+		INSERT INTO user_identities (issuer, subject, user_id, email)
+		VALUES ($1, $2, $3, NULLIF($4, ''))
+		ON CONFLICT (issuer, subject) DO NOTHING
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, issuer, subject, userID, email)
+	return err
+}
+
+// --------------------------------------------------------------------------------------------------------------------------------------
+func (m IdentityModel) GetAllForUser(userID int64) ([]Identity, error) {
+	query := `
+		SELECT issuer, subject, user_id, COALESCE(email, ''), created_at, last_login_at
+		FROM user_identities
+		WHERE user_id = $1
+		ORDER BY created_at
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	identities := []Identity{}
+	for rows.Next() {
+		var identity Identity
+		err := rows.Scan(
+			&identity.Issuer,
+			&identity.Subject,
+			&identity.UserID,
+			&identity.Email,
+			&identity.CreatedAt,
+			&identity.LastLoginAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		identities = append(identities, identity)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return identities, nil
+}
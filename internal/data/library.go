@@ -0,0 +1,121 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// LibraryBook is a book on one of the user's reading lists or reviewed by them, with everything the user has
+// recorded about it. Status is the furthest along the user got with the book on any list, empty when the book
+// was only reviewed.
+type LibraryBook struct {
+	Book
+	Lists      []string
+	Status     string
+	FinishedAt *time.Time
+	Rating     int
+	Review     string
+}
+
+// --------------------------------------------------------------------------------------------------------------------
+// GetLibrary returns every book the user has on a reading list they own or has reviewed, by title
+func (m *ReadingListModel) GetLibrary(userID int64) ([]LibraryBook, error) {
+	query := `
+		WITH entries AS (
+			SELECT rb.book_id, r.name, rb.status, rb.finished_at
+			FROM reading_list_books rb
+			INNER JOIN reading_lists r ON r.id = rb.reading_list_id
+			WHERE r.created_by = $1
+		), library AS (
+			SELECT book_id FROM entries
+			UNION
+			SELECT book_id FROM reviews WHERE user_id = $1
+		)
+		SELECT b.id, b.title, b.isbn, b.publication_date, b.average_rating,
+			ARRAY(
+				SELECT a.name FROM book_authors ba
+				INNER JOIN authors a ON a.id = ba.author_id
+				WHERE ba.book_id = b.id
+				ORDER BY a.id
+			),
+			ARRAY(SELECT DISTINCT e.name FROM entries e WHERE e.book_id = b.id ORDER BY e.name),
+			(
+				SELECT e.status FROM entries e
+				WHERE e.book_id = b.id
+				ORDER BY CASE e.status WHEN 'finished' THEN 0 WHEN 'reading' THEN 1 WHEN 'abandoned' THEN 2 ELSE 3 END
+				LIMIT 1
+			),
+			(SELECT MAX(e.finished_at) FROM entries e WHERE e.book_id = b.id),
+			COALESCE(rv.rating, 0), COALESCE(rv.review, '')
+		FROM library l
+		INNER JOIN books b ON b.id = l.book_id
+		LEFT JOIN reviews rv ON rv.book_id = b.id AND rv.user_id = $1
+		ORDER BY b.title, b.id
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var library []LibraryBook
+	for rows.Next() {
+		var book LibraryBook
+		var status *string
+		err := rows.Scan(
+			&book.ID,
+			&book.Title,
+			&book.ISBN,
+			&book.PublicationDate,
+			&book.AverageRating,
+			pq.Array(&book.Authors),
+			pq.Array(&book.Lists),
+			&status,
+			&book.FinishedAt,
+			&book.Rating,
+			&book.Review,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if status != nil {
+			book.Status = *status
+		}
+		library = append(library, book)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return library, nil
+}
+
+// --------------------------------------------------------------------------------------------------------------------
+// GetOwnedListID returns the id of the user's own list with the given name, ErrRecordNotFound when they have none
+func (m *ReadingListModel) GetOwnedListID(userID int64, name string) (int64, error) {
+	query := `
+		SELECT id FROM reading_lists
+		WHERE created_by = $1 AND name = $2
+		ORDER BY id
+		LIMIT 1
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var id int64
+	err := m.DB.QueryRowContext(ctx, query, userID, name).Scan(&id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrRecordNotFound
+		}
+		return 0, err
+	}
+	return id, nil
+}
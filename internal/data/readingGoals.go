@@ -0,0 +1,239 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/luigiacunaUB/cmps4191-test-3/internal/validator"
+)
+
+var ErrDuplicateGoal = errors.New("duplicate reading goal")
+
+// finishedBooksCTE lists each book user $1 has finished with the first time they finished it. A book counts
+// as finished when it is marked finished on one of the user's reading lists or when the user reviewed it.
+const finishedBooksCTE = `
+	finished AS (
+		SELECT book_id, MIN(finished_at) AS finished_at
+		FROM (
+			SELECT rb.book_id, rb.finished_at
+			FROM reading_list_books rb
+			INNER JOIN reading_lists r ON r.id = rb.reading_list_id
+			WHERE r.created_by = $1 AND rb.status = 'finished' AND rb.finished_at IS NOT NULL
+			UNION ALL
+			SELECT rv.book_id, rv.review_date
+			FROM reviews rv
+			WHERE rv.user_id = $1
+		) f
+		GROUP BY book_id
+	)`
+
+type ReadingGoalModel struct {
+	DB *sql.DB
+}
+
+type ReadingGoal struct {
+	ID        int64     `json:"id"`
+	UserID    int64     `json:"user_id"`
+	Year      int       `json:"year"`
+	Target    int       `json:"target"`
+	Finished  int       `json:"finished"`
+	Progress  float64   `json:"progress_percent"`
+	CreatedAt time.Time `json:"created_at"`
+	Version   int       `json:"version"`
+}
+
+// --------------------------------------------------------------------------------------------------------------------
+func ValidateReadingGoal(v *validator.Validator, goal *ReadingGoal) {
+	v.Check(goal.Year >= 1900, "year", "must be after 1900")
+	v.Check(goal.Year <= time.Now().Year()+1, "year", "must not be more than a year in the future")
+	v.Check(goal.Target > 0, "target", "must be greater than zero")
+	v.Check(goal.Target <= 10000, "target", "must not be more than 10000")
+}
+
+// setProgress works out how far along the goal is from the number of books finished
+func (g *ReadingGoal) setProgress() {
+	g.Progress = float64(g.Finished) / float64(g.Target) * 100
+	if g.Progress > 100 {
+		g.Progress = 100
+	}
+}
+
+// --------------------------------------------------------------------------------------------------------------------
+func (m ReadingGoalModel) Insert(goal *ReadingGoal) error {
+	query := `
+		INSERT INTO reading_goals (user_id, year, target)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at, version
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, goal.UserID, goal.Year, goal.Target).Scan(&goal.ID, &goal.CreatedAt, &goal.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "reading_goals_user_id_year_key"`:
+			return ErrDuplicateGoal
+		default:
+			return err
+		}
+	}
+
+	return m.loadProgress(goal)
+}
+
+// --------------------------------------------------------------------------------------------------------------------
+// Get returns the goal if it belongs to userID
+func (m ReadingGoalModel) Get(id, userID int64) (*ReadingGoal, error) {
+	query := `
+		SELECT id, user_id, year, target, created_at, version
+		FROM reading_goals
+		WHERE id = $1 AND user_id = $2
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var goal ReadingGoal
+	err := m.DB.QueryRowContext(ctx, query, id, userID).Scan(&goal.ID, &goal.UserID, &goal.Year, &goal.Target, &goal.CreatedAt, &goal.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &goal, m.loadProgress(&goal)
+}
+
+// --------------------------------------------------------------------------------------------------------------------
+// GetForYear returns the user's goal for the year, ErrRecordNotFound when they haven't set one
+func (m ReadingGoalModel) GetForYear(userID int64, year int) (*ReadingGoal, error) {
+	query := `
+		SELECT id
+		FROM reading_goals
+		WHERE user_id = $1 AND year = $2
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var id int64
+	err := m.DB.QueryRowContext(ctx, query, userID, year).Scan(&id)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return m.Get(id, userID)
+}
+
+// --------------------------------------------------------------------------------------------------------------------
+func (m ReadingGoalModel) GetAllForUser(userID int64) ([]ReadingGoal, error) {
+	query := `
+		WITH ` + finishedBooksCTE + `
+		SELECT g.id, g.user_id, g.year, g.target, g.created_at, g.version,
+			(SELECT COUNT(*) FROM finished WHERE EXTRACT(YEAR FROM finished.finished_at) = g.year)
+		FROM reading_goals g
+		WHERE g.user_id = $1
+		ORDER BY g.year DESC
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	goals := []ReadingGoal{}
+	for rows.Next() {
+		var goal ReadingGoal
+		err := rows.Scan(&goal.ID, &goal.UserID, &goal.Year, &goal.Target, &goal.CreatedAt, &goal.Version, &goal.Finished)
+		if err != nil {
+			return nil, err
+		}
+		goal.setProgress()
+		goals = append(goals, goal)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return goals, nil
+}
+
+// --------------------------------------------------------------------------------------------------------------------
+// Update changes the target of the goal, the year is fixed once the goal is made
+func (m ReadingGoalModel) Update(goal *ReadingGoal) error {
+	query := `
+		UPDATE reading_goals
+		SET target = $1, version = version + 1
+		WHERE id = $2 AND user_id = $3 AND version = $4
+		RETURNING version
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, goal.Target, goal.ID, goal.UserID, goal.Version).Scan(&goal.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	goal.setProgress()
+	return nil
+}
+
+// --------------------------------------------------------------------------------------------------------------------
+func (m ReadingGoalModel) Delete(id, userID int64) error {
+	query := `
+		DELETE FROM reading_goals
+		WHERE id = $1 AND user_id = $2
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// loadProgress counts the books the goal's owner finished in the goal's year
+func (m ReadingGoalModel) loadProgress(goal *ReadingGoal) error {
+	query := `
+		WITH ` + finishedBooksCTE + `
+		SELECT COUNT(*)
+		FROM finished
+		WHERE EXTRACT(YEAR FROM finished_at) = $2
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, goal.UserID, goal.Year).Scan(&goal.Finished)
+	if err != nil {
+		return err
+	}
+
+	goal.setProgress()
+	return nil
+}
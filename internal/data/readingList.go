@@ -1,10 +1,14 @@
 package data
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"log/slog"
 	"os"
+	"time"
 
+	"github.com/lib/pq"
 	"github.com/luigiacunaUB/cmps4191-test-3/internal/validator"
 )
 
@@ -12,32 +16,193 @@ type ReadingListModel struct {
 	DB *sql.DB
 }
 
+// who can see a reading list, unlisted lists are left out of listings but can be opened by id
+const (
+	VisibilityPublic   = "public"
+	VisibilityPrivate  = "private"
+	VisibilityUnlisted = "unlisted"
+)
+
 type ReadingList struct {
-	ID           int64  `json:"id"`
-	ReadListName string `json:"name"`
-	Books        []int  `json:"book_name"`
-	CreatedBy    int    `json:"createdby"`
-	Description  string `json:"description"`
-	Status       string `json:"status"`
+	ID            int64              `json:"id"`
+	ReadListName  string             `json:"name"`
+	Books         []int              `json:"book_ids"`
+	CreatedBy     int64              `json:"createdby"`
+	Description   string             `json:"description"`
+	Status        string             `json:"status"`
+	Visibility    string             `json:"visibility"`
+	FollowerCount int                `json:"follower_count"`
+	ClonedFrom    *int64             `json:"cloned_from,omitempty"`
+	CloneCount    int                `json:"clone_count"`
+	Entries       []ReadingListEntry `json:"entries"`
+}
+
+// reading state of a single book on a list
+const (
+	EntryWantToRead = "want to read"
+	EntryReading    = "reading"
+	EntryFinished   = "finished"
+	EntryAbandoned  = "abandoned"
+)
+
+// ReadingListEntry is one book on a reading list and how far along the owner is with it
+type ReadingListEntry struct {
+	BookID          int64      `json:"book_id"`
+	Position        int        `json:"position"`
+	Status          string     `json:"status"`
+	CurrentPage     *int       `json:"current_page,omitempty"`
+	ProgressPercent *float64   `json:"progress_percent,omitempty"`
+	StartedAt       *time.Time `json:"started_at,omitempty"`
+	FinishedAt      *time.Time `json:"finished_at,omitempty"`
+	// Book is only filled in when the list is expanded with ?expand=books
+	Book *Book `json:"book,omitempty"`
+}
+
+// entryRow scans the reading_list_books columns of a LEFT JOIN, where every column can be NULL
+type entryRow struct {
+	bookID          *int64
+	position        *int
+	status          *string
+	currentPage     *int
+	progressPercent *float64
+	startedAt       *time.Time
+	finishedAt      *time.Time
+}
+
+// readingListColumns selects a reading list aliased r, it must stay in the same order as ReadingList.destinations
+const readingListColumns = `r.id, r.name, r.description, r.created_by, r.status, r.visibility, r.cloned_from,
+	(SELECT COUNT(*) FROM reading_list_followers f WHERE f.reading_list_id = r.id),
+	(SELECT COUNT(*) FROM reading_lists cl WHERE cl.cloned_from = r.id)`
+
+func (l *ReadingList) destinations() []any {
+	return []any{&l.ID, &l.ReadListName, &l.Description, &l.CreatedBy, &l.Status, &l.Visibility, &l.ClonedFrom, &l.FollowerCount, &l.CloneCount}
+}
+
+// entryColumns must stay in the same order as entryRow.destinations
+const entryColumns = `rb.book_id, rb.position, rb.status, rb.current_page, rb.progress_percent, rb.started_at, rb.finished_at`
+
+func (e *entryRow) destinations() []any {
+	return []any{&e.bookID, &e.position, &e.status, &e.currentPage, &e.progressPercent, &e.startedAt, &e.finishedAt}
+}
+
+// entry returns the scanned entry, ok is false when the list had no books
+func (e *entryRow) entry() (ReadingListEntry, bool) {
+	if e.bookID == nil {
+		return ReadingListEntry{}, false
+	}
+	return ReadingListEntry{
+		BookID:          *e.bookID,
+		Position:        *e.position,
+		Status:          *e.status,
+		CurrentPage:     e.currentPage,
+		ProgressPercent: e.progressPercent,
+		StartedAt:       e.startedAt,
+		FinishedAt:      e.finishedAt,
+	}, true
+}
+
+// BookIDs returns the ids of every book on the lists, each id once
+func BookIDs(lists []ReadingList) []int64 {
+	seen := make(map[int64]bool)
+	var ids []int64
+	for _, list := range lists {
+		for _, entry := range list.Entries {
+			if !seen[entry.BookID] {
+				seen[entry.BookID] = true
+				ids = append(ids, entry.BookID)
+			}
+		}
+	}
+	return ids
+}
+
+// AttachBooks points every entry on the lists at its book
+func AttachBooks(lists []ReadingList, books map[int64]Book) {
+	for i := range lists {
+		for j := range lists[i].Entries {
+			if book, ok := books[lists[i].Entries[j].BookID]; ok {
+				lists[i].Entries[j].Book = &book
+			}
+		}
+	}
+}
+
+// what happened to each book in a bulk add or remove
+const (
+	BookAdded          = "added"
+	BookAlreadyPresent = "already_present"
+	BookNotFound       = "not_found"
+	BookRemoved        = "removed"
+)
+
+// BookChange is the result of adding or removing one book, Position is where an added book ended up
+type BookChange struct {
+	BookID   int64  `json:"book_id"`
+	Result   string `json:"result"`
+	Position int    `json:"position,omitempty"`
+}
+
+// CanView reports whether a user with the given role on the list may see it, everyone can see
+// lists that are not private
+func (l ReadingList) CanView(role string) bool {
+	return l.Visibility != VisibilityPrivate || role != ""
+}
+
+// IsOwner reports whether the user created the list
+func (l ReadingList) IsOwner(userID int64) bool {
+	return l.CreatedBy == userID
+}
+
+// --------------------------------------------------------------------------------------------------------------------
+// ValidateReadingListName checks a name that was given, creating a list also requires one
+func ValidateReadingListName(v *validator.Validator, name string) {
+	v.Check(len(name) <= 25, "Title", "Must not be more than 25 bytes long")
 }
 
 // --------------------------------------------------------------------------------------------------------------------
 func ValidateReadingList(v *validator.Validator, rl ReadingListModel, list *ReadingList) {
 	//Check the name of the Reading List
 	v.Check(list.ReadListName != "", "Reading List:", "The name must not be empty")
-	v.Check(len(list.ReadListName) <= 25, "Title", "Must not be more than 25 bytes long")
+	ValidateReadingListName(v, list.ReadListName)
 	//Book Validation Check
 	v.Check(len(list.Books) > 0, "Books", "At least one book ID must be provided")
+	seen := make(map[int]bool, len(list.Books))
 	for _, bookID := range list.Books {
 		v.Check(bookID > 0, "Books", "Book ID must be a positive integer")
+		v.Check(!seen[bookID], "Books", "Book IDs must not be repeated")
+		seen[bookID] = true
 	}
 	//Descritption Check
 	v.Check(list.Description != "", "Description", "Must not be Empty")
 	v.Check(len(list.Description) <= 100, "Description", "Must not be more than 100 bytes long")
-	//Status Check
-	validStatuses := []string{"currently reading", "completed"}
-	v.Check(stringInSlice(list.Status, validStatuses), "Status", "Status must be either 'currently reading' or 'completed'")
+	//Visibility Check
+	ValidateVisibility(v, list.Visibility)
+}
 
+func ValidateVisibility(v *validator.Validator, visibility string) {
+	validVisibilities := []string{VisibilityPublic, VisibilityPrivate, VisibilityUnlisted}
+	v.Check(stringInSlice(visibility, validVisibilities), "Visibility", "Visibility must be 'public', 'private' or 'unlisted'")
+}
+
+// --------------------------------------------------------------------------------------------------------------------
+func ValidateReadingListEntry(v *validator.Validator, entry *ReadingListEntry) {
+	validStatuses := []string{EntryWantToRead, EntryReading, EntryFinished, EntryAbandoned}
+	v.Check(stringInSlice(entry.Status, validStatuses), "status", "Status must be 'want to read', 'reading', 'finished' or 'abandoned'")
+	if entry.CurrentPage != nil {
+		v.Check(*entry.CurrentPage >= 0, "current_page", "must not be negative")
+	}
+	if entry.ProgressPercent != nil {
+		v.Check(*entry.ProgressPercent >= 0 && *entry.ProgressPercent <= 100, "progress_percent", "must be between 0 and 100")
+	}
+	if entry.StartedAt != nil {
+		v.Check(entry.StartedAt.Before(time.Now()), "started_at", "must not be in the future")
+	}
+	if entry.FinishedAt != nil {
+		v.Check(entry.FinishedAt.Before(time.Now()), "finished_at", "must not be in the future")
+		if entry.StartedAt != nil {
+			v.Check(!entry.FinishedAt.Before(*entry.StartedAt), "finished_at", "must not be before started_at")
+		}
+	}
 }
 
 func stringInSlice(value string, list []string) bool {
@@ -49,55 +214,93 @@ func stringInSlice(value string, list []string) bool {
 	return false
 }
 
-func (rl ReadingListModel) AddReadingListToDatabase(list ReadingList) (ReadingList, error) {
+// AddReadingListToDatabase creates the list with its books in the order given. If any book doesn't exist or is
+// given twice nothing is created, and ErrBulkIncomplete is returned with what would have happened to each book.
+func (rl ReadingListModel) AddReadingListToDatabase(list ReadingList) (ReadingList, []BookChange, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
 	// Begin a transaction
-	tx, err := rl.DB.Begin()
+	tx, err := rl.DB.BeginTx(ctx, nil)
 	if err != nil {
-		return list, err
+		return list, nil, err
 	}
 
 	defer tx.Rollback() // Rollback in case of an error
 
+	// Check the books before creating anything, the same way adding books to an existing list does
+	bookIDs := make([]int64, len(list.Books))
+	for i, bookID := range list.Books {
+		bookIDs[i] = int64(bookID)
+	}
+	exists, err := bookIDSet(ctx, tx, `SELECT id FROM books WHERE id = ANY($1)`, pq.Array(bookIDs))
+	if err != nil {
+		return list, nil, err
+	}
+	results := make([]BookChange, 0, len(bookIDs))
+	onList := make(map[int64]bool, len(bookIDs))
+	complete := true
+	for _, bookID := range bookIDs {
+		change := BookChange{BookID: bookID}
+		switch {
+		case !exists[bookID]:
+			change.Result = BookNotFound
+			complete = false
+		case onList[bookID]:
+			change.Result = BookAlreadyPresent
+			complete = false
+		default:
+			change.Result = BookAdded
+			change.Position = len(onList) + 1
+			onList[bookID] = true
+		}
+		results = append(results, change)
+	}
+	if !complete {
+		return list, results, ErrBulkIncomplete
+	}
+
 	// Insert into reading_lists
 	query := `
-		 INSERT INTO reading_lists (name, description, created_by, status)
+		 INSERT INTO reading_lists (name, description, created_by, visibility)
 		 VALUES ($1, $2, $3, $4)
-		 RETURNING id
+		 RETURNING id, status
 	 `
 	var id int64
-	err = tx.QueryRow(query, list.ReadListName, list.Description, list.CreatedBy, list.Status).Scan(&id)
+	err = tx.QueryRowContext(ctx, query, list.ReadListName, list.Description, list.CreatedBy, list.Visibility).Scan(&id, &list.Status)
 	if err != nil {
-		return list, err
+		return list, nil, err
 	}
 
-	// Insert into reading_list_books
-	for _, bookID := range list.Books {
+	// Insert into reading_list_books, in the order the books were given
+	if len(bookIDs) > 0 {
 		query = `
-			 INSERT INTO reading_list_books (reading_list_id, book_id)
-			 VALUES ($1, $2)
-		 `
-		_, err = tx.Exec(query, id, bookID)
+			INSERT INTO reading_list_books (reading_list_id, book_id, position)
+			SELECT $1, o.book_id, o.ordinality
+			FROM unnest($2::int[]) WITH ORDINALITY AS o(book_id, ordinality)
+		`
+		_, err = tx.ExecContext(ctx, query, id, pq.Array(bookIDs))
 		if err != nil {
-			return list, err
+			return list, nil, err
 		}
 	}
 
 	// Commit the transaction
 	err = tx.Commit()
 	if err != nil {
-		return list, err
+		return list, nil, err
 	}
 
 	// Return the updated ReadingList
 	list.ID = id
-	return list, nil
+	return list, results, nil
 }
 
 // ----------------------------------------------------------------------------------------------------------------------------------------------------------------
 func (m *ReadingListModel) DeleteReadingList(readingListID int64) error {
 	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
 	logger.Info("Inside DELETEREADINGLISTHANDLER SQL")
-	logger.Info("ID to be deleted in SQL func: ", readingListID)
+	logger.Info("ID to be deleted in SQL func", "id", readingListID)
 	// Delete the reading list
 	query := `
         DELETE FROM reading_lists
@@ -114,27 +317,67 @@ func (m *ReadingListModel) DeleteReadingList(readingListID int64) error {
 		return err
 	}
 	if rowsAffected == 0 {
-		return err
+		return ErrRecordNotFound
 	}
 
 	return nil
 }
 
 // -------------------------------------------------------------------------------------------------------------------------------------------------------------------
-func (m *ReadingListModel) GetAllReadingLists() ([]ReadingList, error) {
+// GetAllReadingLists returns the public lists plus every list the viewer owns or has been invited to
+func (m *ReadingListModel) GetAllReadingLists(viewerID int64) ([]ReadingList, error) {
 	// Query to fetch all reading lists and their associated book IDs
 	query := `
-        SELECT r.id, r.name, r.description, r.created_by, r.status, rb.book_id
+        SELECT ` + readingListColumns + `, ` + entryColumns + `
+        FROM reading_lists r
+        LEFT JOIN reading_list_books rb ON r.id = rb.reading_list_id
+        WHERE r.visibility = 'public' OR r.created_by = $1
+        OR EXISTS (
+            SELECT 1 FROM reading_list_collaborators c
+            WHERE c.reading_list_id = r.id AND c.user_id = $1
+        )
+        ORDER BY r.id ASC, rb.position ASC
+    `
+	rows, err := m.DB.Query(query, viewerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanReadingLists(rows)
+}
+
+// -------------------------------------------------------------------------------------------------------------------------------------------------------------------
+// GetOwnedReadingLists returns every list the user created, whatever its visibility
+func (m *ReadingListModel) GetOwnedReadingLists(userID int64) ([]ReadingList, error) {
+	query := `
+        SELECT ` + readingListColumns + `, ` + entryColumns + `
         FROM reading_lists r
         LEFT JOIN reading_list_books rb ON r.id = rb.reading_list_id
-        ORDER BY r.id ASC
+        WHERE r.created_by = $1
+        ORDER BY r.id ASC, rb.position ASC
     `
-	rows, err := m.DB.Query(query)
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
+	lists, err := scanReadingLists(rows)
+	if err != nil {
+		return nil, err
+	}
+	if lists == nil {
+		lists = []ReadingList{}
+	}
+	return lists, nil
+}
+
+// scanReadingLists groups the rows of a reading list LEFT JOIN reading_list_books query, ordered by list, into lists
+func scanReadingLists(rows *sql.Rows) ([]ReadingList, error) {
 	// Slice to hold the reading lists
 	var readingLists []ReadingList
 	var currentList *ReadingList
@@ -142,8 +385,9 @@ func (m *ReadingListModel) GetAllReadingLists() ([]ReadingList, error) {
 	// Loop through the result set and populate the slice
 	for rows.Next() {
 		var list ReadingList
-		var bookID *int
-		err := rows.Scan(&list.ID, &list.ReadListName, &list.Description, &list.CreatedBy, &list.Status, &bookID)
+		var row entryRow
+		dest := append(list.destinations(), row.destinations()...)
+		err := rows.Scan(dest...)
 		if err != nil {
 			return nil, err
 		}
@@ -157,11 +401,13 @@ func (m *ReadingListModel) GetAllReadingLists() ([]ReadingList, error) {
 			// Start a new reading list
 			currentList = &list
 			currentList.Books = []int{}
+			currentList.Entries = []ReadingListEntry{}
 		}
 
-		// Append the book ID to the current reading list
-		if bookID != nil {
-			currentList.Books = append(currentList.Books, *bookID)
+		// Append the book to the current reading list
+		if entry, ok := row.entry(); ok {
+			currentList.Books = append(currentList.Books, int(entry.BookID))
+			currentList.Entries = append(currentList.Entries, entry)
 		}
 	}
 
@@ -170,7 +416,7 @@ func (m *ReadingListModel) GetAllReadingLists() ([]ReadingList, error) {
 		readingLists = append(readingLists, *currentList)
 	}
 
-	if err = rows.Err(); err != nil {
+	if err := rows.Err(); err != nil {
 		return nil, err
 	}
 
@@ -181,11 +427,11 @@ func (m *ReadingListModel) GetAllReadingLists() ([]ReadingList, error) {
 func (m *ReadingListModel) GetReadingListByID(id int64) (ReadingList, error) {
 	// Query to fetch the reading list with its associated book IDs by reading list ID
 	query := `
-        SELECT r.id, r.name, r.description, r.created_by, r.status, rb.book_id
+        SELECT ` + readingListColumns + `, ` + entryColumns + `
         FROM reading_lists r
         LEFT JOIN reading_list_books rb ON r.id = rb.reading_list_id
         WHERE r.id = $1
-        ORDER BY r.id ASC
+        ORDER BY r.id ASC, rb.position ASC
     `
 	rows, err := m.DB.Query(query, id)
 	if err != nil {
@@ -196,11 +442,12 @@ func (m *ReadingListModel) GetReadingListByID(id int64) (ReadingList, error) {
 	// Initialize a variable to store the reading list
 	var readingList ReadingList
 	var currentList *ReadingList
-	var bookID *int
+	var row entryRow
+	dest := append(readingList.destinations(), row.destinations()...)
 
 	// Loop through the result set and populate the reading list
 	for rows.Next() {
-		err := rows.Scan(&readingList.ID, &readingList.ReadListName, &readingList.Description, &readingList.CreatedBy, &readingList.Status, &bookID)
+		err := rows.Scan(dest...)
 		if err != nil {
 			return ReadingList{}, err
 		}
@@ -209,11 +456,13 @@ func (m *ReadingListModel) GetReadingListByID(id int64) (ReadingList, error) {
 		if currentList == nil {
 			currentList = &readingList
 			currentList.Books = []int{}
+			currentList.Entries = []ReadingListEntry{}
 		}
 
-		// Append the book ID to the current reading list if it's not NULL
-		if bookID != nil {
-			currentList.Books = append(currentList.Books, *bookID)
+		// Append the book to the current reading list if it's not NULL
+		if entry, ok := row.entry(); ok {
+			currentList.Books = append(currentList.Books, int(entry.BookID))
+			currentList.Entries = append(currentList.Entries, entry)
 		}
 	}
 
@@ -223,32 +472,171 @@ func (m *ReadingListModel) GetReadingListByID(id int64) (ReadingList, error) {
 
 	// If no reading list was found, return an error
 	if currentList == nil {
-		return ReadingList{}, err
+		return ReadingList{}, ErrRecordNotFound
 	}
 
 	return *currentList, nil
 }
 
 // -------------------------------------------------------------------------------------------------------------------------------------------------------------
-func (m *ReadingListModel) AddBookToReadingList(readingListID, bookID int64) error {
-	// Query to insert a new book into the reading_list_books table
+// AddBooksToReadingList inserts the books, in the order given, starting at position and moving later books down.
+// A position of 0 or past the end of the list appends the books. Books already on the list or that don't exist
+// are skipped and reported in the results; with allOrNothing nothing is added unless every book can be, and
+// ErrBulkIncomplete is returned along with the results.
+func (m *ReadingListModel) AddBooksToReadingList(readingListID int64, bookIDs []int64, position int, allOrNothing bool) ([]BookChange, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	count, err := lockReadingListBooks(ctx, tx, readingListID)
+	if err != nil {
+		return nil, err
+	}
+	if position < 1 || position > count+1 {
+		position = count + 1
+	}
+
+	onList, err := bookIDSet(ctx, tx, `SELECT book_id FROM reading_list_books WHERE reading_list_id = $1`, readingListID)
+	if err != nil {
+		return nil, err
+	}
+	exists, err := bookIDSet(ctx, tx, `SELECT id FROM books WHERE id = ANY($1)`, pq.Array(bookIDs))
+	if err != nil {
+		return nil, err
+	}
+
+	// Work out what happens to each book before changing anything
+	results := make([]BookChange, 0, len(bookIDs))
+	var toAdd []int64
+	for _, bookID := range bookIDs {
+		change := BookChange{BookID: bookID}
+		switch {
+		case !exists[bookID]:
+			change.Result = BookNotFound
+		case onList[bookID]:
+			change.Result = BookAlreadyPresent
+		default:
+			change.Result = BookAdded
+			change.Position = position + len(toAdd)
+			toAdd = append(toAdd, bookID)
+			onList[bookID] = true
+		}
+		results = append(results, change)
+	}
+	if allOrNothing && len(toAdd) != len(bookIDs) {
+		return results, ErrBulkIncomplete
+	}
+	if len(toAdd) == 0 {
+		return results, nil
+	}
+
+	// Make room for the new books
 	query := `
-		INSERT INTO reading_list_books (reading_list_id, book_id)
-		VALUES ($1, $2)
+		UPDATE reading_list_books
+		SET position = position + $3
+		WHERE reading_list_id = $1 AND position >= $2
 	`
-	_, err := m.DB.Exec(query, readingListID, bookID)
-	return err
+	_, err = tx.ExecContext(ctx, query, readingListID, position, len(toAdd))
+	if err != nil {
+		return nil, err
+	}
+
+	query = `
+		INSERT INTO reading_list_books (reading_list_id, book_id, position)
+		SELECT $1, o.book_id, $2 + o.ordinality - 1
+		FROM unnest($3::int[]) WITH ORDINALITY AS o(book_id, ordinality)
+	`
+	_, err = tx.ExecContext(ctx, query, readingListID, position, pq.Array(toAdd))
+	if err != nil {
+		return nil, err
+	}
+
+	// New books mean the list is being read again
+	_, err = refreshReadingListStatus(ctx, tx, readingListID)
+	if err != nil {
+		return nil, err
+	}
+
+	return results, tx.Commit()
 }
 
 // ----------------------------------------------------------------------------------------------------------------------------------------------------------------
-func (m *ReadingListModel) DeleteBookFromReadingList(readingListID, bookID int64) error {
-	// Query to delete a book from the reading_list_books table
+// RemoveBooksFromReadingList takes the books off the list and closes the gaps they leave. Books that are not on the
+// list are reported as not found; with allOrNothing nothing is removed unless every book is on the list.
+func (m *ReadingListModel) RemoveBooksFromReadingList(readingListID int64, bookIDs []int64, allOrNothing bool) ([]BookChange, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, err = lockReadingListBooks(ctx, tx, readingListID)
+	if err != nil {
+		return nil, err
+	}
+
+	onList, err := bookIDSet(ctx, tx, `SELECT book_id FROM reading_list_books WHERE reading_list_id = $1`, readingListID)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]BookChange, 0, len(bookIDs))
+	var toRemove []int64
+	for _, bookID := range bookIDs {
+		change := BookChange{BookID: bookID, Result: BookNotFound}
+		if onList[bookID] {
+			change.Result = BookRemoved
+			toRemove = append(toRemove, bookID)
+			delete(onList, bookID)
+		}
+		results = append(results, change)
+	}
+	if allOrNothing && len(toRemove) != len(bookIDs) {
+		return results, ErrBulkIncomplete
+	}
+	if len(toRemove) == 0 {
+		return results, nil
+	}
+
 	query := `
 		DELETE FROM reading_list_books
-		WHERE reading_list_id = $1 AND book_id = $2
+		WHERE reading_list_id = $1 AND book_id = ANY($2)
 	`
-	_, err := m.DB.Exec(query, readingListID, bookID)
-	return err
+	_, err = tx.ExecContext(ctx, query, readingListID, pq.Array(toRemove))
+	if err != nil {
+		return nil, err
+	}
+
+	// Close the gaps the books left behind
+	query = `
+		UPDATE reading_list_books rb
+		SET position = o.position
+		FROM (
+			SELECT book_id, ROW_NUMBER() OVER (ORDER BY position) AS position
+			FROM reading_list_books
+			WHERE reading_list_id = $1
+		) o
+		WHERE rb.reading_list_id = $1 AND rb.book_id = o.book_id AND rb.position <> o.position
+	`
+	_, err = tx.ExecContext(ctx, query, readingListID)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = refreshReadingListStatus(ctx, tx, readingListID)
+	if err != nil {
+		return nil, err
+	}
+
+	return results, tx.Commit()
 }
 
 // -----------------------------------------------------------------------------------------------------------------------------------------------------------------
@@ -258,9 +646,225 @@ func (m *ReadingListModel) UpdateReadingListInfo(list ReadingList) error {
 		SET
 			name = COALESCE(NULLIF($1, ''), name),
 			description = COALESCE(NULLIF($2, ''), description),
-			status = COALESCE(NULLIF($3, ''), status)
+			visibility = COALESCE(NULLIF($3, ''), visibility)
 		WHERE id = $4
 	`
-	_, err := m.DB.Exec(query, list.ReadListName, list.Description, list.Status, list.ID)
+	_, err := m.DB.Exec(query, list.ReadListName, list.Description, list.Visibility, list.ID)
 	return err
 }
+
+// -----------------------------------------------------------------------------------------------------------------------------------------------------------------
+func (m *ReadingListModel) GetEntry(readingListID, bookID int64) (ReadingListEntry, error) {
+	query := `
+		SELECT ` + entryColumns + `
+		FROM reading_list_books rb
+		WHERE rb.reading_list_id = $1 AND rb.book_id = $2
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var row entryRow
+	err := m.DB.QueryRowContext(ctx, query, readingListID, bookID).Scan(row.destinations()...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ReadingListEntry{}, ErrRecordNotFound
+		default:
+			return ReadingListEntry{}, err
+		}
+	}
+
+	entry, _ := row.entry()
+	return entry, nil
+}
+
+// -----------------------------------------------------------------------------------------------------------------------------------------------------------------
+// UpdateEntry saves the reading state of one book and returns the list's new overall status
+func (m *ReadingListModel) UpdateEntry(readingListID int64, entry ReadingListEntry) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE reading_list_books
+		SET status = $1, current_page = $2, progress_percent = $3, started_at = $4, finished_at = $5
+		WHERE reading_list_id = $6 AND book_id = $7
+	`
+	args := []any{entry.Status, entry.CurrentPage, entry.ProgressPercent, entry.StartedAt, entry.FinishedAt, readingListID, entry.BookID}
+	result, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return "", err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return "", err
+	}
+	if rowsAffected == 0 {
+		return "", ErrRecordNotFound
+	}
+
+	status, err := refreshReadingListStatus(ctx, tx, readingListID)
+	if err != nil {
+		return "", err
+	}
+
+	return status, tx.Commit()
+}
+
+// -----------------------------------------------------------------------------------------------------------------------------------------------------------------
+// ReorderBooks puts the books on the list in the order given, which must name every book on the list exactly once
+func (m *ReadingListModel) ReorderBooks(readingListID int64, bookIDs []int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	count, err := lockReadingListBooks(ctx, tx, readingListID)
+	if err != nil {
+		return err
+	}
+	if count != len(bookIDs) {
+		return ErrReadingListOrder
+	}
+
+	// the unique (reading_list_id, position) constraint is deferred, so the swap is checked at commit
+	query := `
+		UPDATE reading_list_books rb
+		SET position = o.position
+		FROM unnest($2::int[]) WITH ORDINALITY AS o(book_id, position)
+		WHERE rb.reading_list_id = $1 AND rb.book_id = o.book_id
+	`
+	result, err := tx.ExecContext(ctx, query, readingListID, pq.Array(bookIDs))
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	// duplicates or books that are not on the list leave some rows untouched
+	if rowsAffected != int64(count) {
+		return ErrReadingListOrder
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code.Name() == "unique_violation" {
+			return ErrReadingListOrder
+		}
+		return err
+	}
+	return nil
+}
+
+// -----------------------------------------------------------------------------------------------------------------------------------------------------------------
+// CloneReadingList copies the list and its books, in the same order, into a new list owned by ownerID and returns
+// the new list's id. The copy starts with every book unread; an empty name keeps the original's name.
+func (m *ReadingListModel) CloneReadingList(sourceID, ownerID int64, name, visibility string) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO reading_lists (name, description, created_by, visibility, cloned_from)
+		SELECT COALESCE(NULLIF($2, ''), name), description, $3, $4, id
+		FROM reading_lists
+		WHERE id = $1
+		RETURNING id
+	`
+	var id int64
+	err = tx.QueryRowContext(ctx, query, sourceID, name, ownerID, visibility).Scan(&id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrRecordNotFound
+		}
+		return 0, err
+	}
+
+	query = `
+		INSERT INTO reading_list_books (reading_list_id, book_id, position)
+		SELECT $1, book_id, position
+		FROM reading_list_books
+		WHERE reading_list_id = $2
+	`
+	_, err = tx.ExecContext(ctx, query, id, sourceID)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, tx.Commit()
+}
+
+// bookIDSet runs a query returning a single column of book ids and collects them into a set
+func bookIDSet(ctx context.Context, tx *sql.Tx, query string, args ...any) (map[int64]bool, error) {
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make(map[int64]bool)
+	for rows.Next() {
+		var id int64
+		err := rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+		ids[id] = true
+	}
+	return ids, rows.Err()
+}
+
+// lockReadingListBooks locks the list row so concurrent changes to its order queue up, and returns
+// how many books the list has
+func lockReadingListBooks(ctx context.Context, tx *sql.Tx, readingListID int64) (int, error) {
+	var id int64
+	err := tx.QueryRowContext(ctx, `SELECT id FROM reading_lists WHERE id = $1 FOR UPDATE`, readingListID).Scan(&id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrRecordNotFound
+		}
+		return 0, err
+	}
+
+	var count int
+	err = tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM reading_list_books WHERE reading_list_id = $1`, readingListID).Scan(&count)
+	return count, err
+}
+
+// refreshReadingListStatus derives the list's status from its entries: a list is completed once it has
+// books and every one of them is finished or abandoned
+func refreshReadingListStatus(ctx context.Context, tx *sql.Tx, readingListID int64) (string, error) {
+	query := `
+		UPDATE reading_lists
+		SET status = CASE
+			WHEN EXISTS (SELECT 1 FROM reading_list_books WHERE reading_list_id = $1)
+			AND NOT EXISTS (
+				SELECT 1 FROM reading_list_books
+				WHERE reading_list_id = $1 AND status IN ('want to read', 'reading')
+			)
+			THEN 'completed'
+			ELSE 'currently reading'
+		END
+		WHERE id = $1
+		RETURNING status
+	`
+	var status string
+	err := tx.QueryRowContext(ctx, query, readingListID).Scan(&status)
+	return status, err
+}
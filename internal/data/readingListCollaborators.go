@@ -0,0 +1,220 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/luigiacunaUB/cmps4191-test-3/internal/validator"
+)
+
+// the role a user has on a reading list, owners are whoever created the list and are not stored as collaborators
+const (
+	RoleOwner  = "owner"
+	RoleEditor = "editor"
+	RoleViewer = "viewer"
+)
+
+// InvitationTTL is how long an invitation to collaborate can be accepted
+const InvitationTTL = 7 * 24 * time.Hour
+
+// Collaborator is a user a reading list has been shared with. Their email address is left out, everyone who can
+// see the list can see its collaborators.
+type Collaborator struct {
+	UserID   int64     `json:"user_id"`
+	Username string    `json:"username"`
+	Role     string    `json:"role"`
+	AddedAt  time.Time `json:"added_at"`
+}
+
+// Invitation is an email address the owner invited to collaborate that hasn't accepted yet
+type Invitation struct {
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	InvitedAt time.Time `json:"invited_at"`
+	Expiry    time.Time `json:"expiry"`
+}
+
+// CanEditBooks reports whether the role allows adding, removing and reordering the books on a list
+func CanEditBooks(role string) bool {
+	return role == RoleOwner || role == RoleEditor
+}
+
+// --------------------------------------------------------------------------------------------------------------------
+func ValidateCollaboratorRole(v *validator.Validator, role string) {
+	validRoles := []string{RoleViewer, RoleEditor}
+	v.Check(stringInSlice(role, validRoles), "role", "Role must be 'viewer' or 'editor'")
+}
+
+// --------------------------------------------------------------------------------------------------------------------
+// RoleFor returns the user's role on the list, or "" when the list has not been shared with them
+func (m *ReadingListModel) RoleFor(list ReadingList, userID int64) (string, error) {
+	if list.IsOwner(userID) {
+		return RoleOwner, nil
+	}
+
+	query := `
+		SELECT role
+		FROM reading_list_collaborators
+		WHERE reading_list_id = $1 AND user_id = $2
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var role string
+	err := m.DB.QueryRowContext(ctx, query, list.ID, userID).Scan(&role)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", nil
+		}
+		return "", err
+	}
+	return role, nil
+}
+
+// --------------------------------------------------------------------------------------------------------------------
+func (m *ReadingListModel) GetCollaborators(readingListID int64) ([]Collaborator, error) {
+	query := `
+		SELECT c.user_id, u.username, c.role, c.added_at
+		FROM reading_list_collaborators c
+		INNER JOIN users u ON u.id = c.user_id
+		WHERE c.reading_list_id = $1
+		ORDER BY c.added_at ASC, c.user_id ASC
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, readingListID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	collaborators := []Collaborator{}
+	for rows.Next() {
+		var c Collaborator
+		err := rows.Scan(&c.UserID, &c.Username, &c.Role, &c.AddedAt)
+		if err != nil {
+			return nil, err
+		}
+		collaborators = append(collaborators, c)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return collaborators, nil
+}
+
+// --------------------------------------------------------------------------------------------------------------------
+func (m *ReadingListModel) RemoveCollaborator(readingListID, userID int64) error {
+	query := `
+		DELETE FROM reading_list_collaborators
+		WHERE reading_list_id = $1 AND user_id = $2
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, readingListID, userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// --------------------------------------------------------------------------------------------------------------------
+// InviteCollaborator records an invitation for the email address, inviting the same address again renews it with the new role
+func (m *ReadingListModel) InviteCollaborator(readingListID int64, email, role string) error {
+	query := `
+		INSERT INTO reading_list_invitations (reading_list_id, email, role, expiry)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (reading_list_id, email) DO UPDATE
+		SET role = EXCLUDED.role, invited_at = NOW(), expiry = EXCLUDED.expiry
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Invitations nobody accepted are cleared out on the way
+	_, err := m.DB.ExecContext(ctx, `DELETE FROM reading_list_invitations WHERE expiry <= $1`, time.Now())
+	if err != nil {
+		return err
+	}
+
+	_, err = m.DB.ExecContext(ctx, query, readingListID, email, role, time.Now().Add(InvitationTTL))
+	return err
+}
+
+// --------------------------------------------------------------------------------------------------------------------
+func (m *ReadingListModel) GetInvitations(readingListID int64) ([]Invitation, error) {
+	query := `
+		SELECT email, role, invited_at, expiry
+		FROM reading_list_invitations
+		WHERE reading_list_id = $1 AND expiry > $2
+		ORDER BY invited_at ASC, email ASC
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, readingListID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invitations := []Invitation{}
+	for rows.Next() {
+		var i Invitation
+		err := rows.Scan(&i.Email, &i.Role, &i.InvitedAt, &i.Expiry)
+		if err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, i)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return invitations, nil
+}
+
+// --------------------------------------------------------------------------------------------------------------------
+// AcceptInvitation turns the invitation for the user's email address into a collaborator in one step
+func (m *ReadingListModel) AcceptInvitation(readingListID, userID int64, email string) (Collaborator, error) {
+	query := `
+		WITH accepted AS (
+			DELETE FROM reading_list_invitations
+			WHERE reading_list_id = $1 AND email = $3 AND expiry > $4
+			RETURNING role
+		), upserted AS (
+			INSERT INTO reading_list_collaborators (reading_list_id, user_id, role)
+			SELECT $1, $2, role FROM accepted
+			ON CONFLICT (reading_list_id, user_id) DO UPDATE SET role = EXCLUDED.role
+			RETURNING user_id, role, added_at
+		)
+		SELECT up.user_id, u.username, up.role, up.added_at
+		FROM upserted up
+		INNER JOIN users u ON u.id = up.user_id
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var c Collaborator
+	err := m.DB.QueryRowContext(ctx, query, readingListID, userID, email, time.Now()).Scan(&c.UserID, &c.Username, &c.Role, &c.AddedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return Collaborator{}, ErrRecordNotFound
+		default:
+			return Collaborator{}, err
+		}
+	}
+	return c, nil
+}
@@ -0,0 +1,121 @@
+package data
+
+import (
+	"context"
+	"time"
+)
+
+// --------------------------------------------------------------------------------------------------------------------
+// Follow subscribes the user to the list, following a list twice is not an error
+func (m *ReadingListModel) Follow(readingListID, userID int64) error {
+	query := `
+		INSERT INTO reading_list_followers (reading_list_id, user_id)
+		VALUES ($1, $2)
+		ON CONFLICT (reading_list_id, user_id) DO NOTHING
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, readingListID, userID)
+	return err
+}
+
+// --------------------------------------------------------------------------------------------------------------------
+func (m *ReadingListModel) Unfollow(readingListID, userID int64) error {
+	query := `
+		DELETE FROM reading_list_followers
+		WHERE reading_list_id = $1 AND user_id = $2
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, readingListID, userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// --------------------------------------------------------------------------------------------------------------------
+// GetFollowedReadingLists returns the lists the user follows, leaving out lists that have since been made
+// private unless the user is a collaborator on them
+func (m *ReadingListModel) GetFollowedReadingLists(userID int64) ([]ReadingList, error) {
+	query := `
+        SELECT ` + readingListColumns + `, ` + entryColumns + `
+        FROM reading_list_followers fl
+        INNER JOIN reading_lists r ON r.id = fl.reading_list_id
+        LEFT JOIN reading_list_books rb ON r.id = rb.reading_list_id
+        WHERE fl.user_id = $1
+        AND (r.visibility <> 'private' OR r.created_by = $1 OR EXISTS (
+            SELECT 1 FROM reading_list_collaborators c
+            WHERE c.reading_list_id = r.id AND c.user_id = $1
+        ))
+        ORDER BY r.id ASC, rb.position ASC
+    `
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lists, err := scanReadingLists(rows)
+	if err != nil {
+		return nil, err
+	}
+	if lists == nil {
+		lists = []ReadingList{}
+	}
+	return lists, nil
+}
+
+// --------------------------------------------------------------------------------------------------------------------
+// GetFollowersToNotify returns the activated followers of the list who want update emails and can still see
+// the list, excludeUserID is left out so people aren't told about their own changes
+func (m *ReadingListModel) GetFollowersToNotify(readingListID, excludeUserID int64) ([]User, error) {
+	query := `
+		SELECT u.id, u.username, u.email
+		FROM reading_list_followers fl
+		INNER JOIN users u ON u.id = fl.user_id
+		INNER JOIN reading_lists r ON r.id = fl.reading_list_id
+		WHERE fl.reading_list_id = $1
+		AND u.id <> $2
+		AND u.activated AND u.notify_list_updates
+		AND (r.visibility <> 'private' OR r.created_by = u.id OR EXISTS (
+			SELECT 1 FROM reading_list_collaborators c
+			WHERE c.reading_list_id = r.id AND c.user_id = u.id
+		))
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, readingListID, excludeUserID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var followers []User
+	for rows.Next() {
+		var user User
+		err := rows.Scan(&user.ID, &user.Username, &user.Email)
+		if err != nil {
+			return nil, err
+		}
+		followers = append(followers, user)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return followers, nil
+}
@@ -0,0 +1,168 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// how many genres and authors the stats list
+const statsTopCount = 5
+
+type ReadingStatsModel struct {
+	DB *sql.DB
+}
+
+type MonthCount struct {
+	Month int `json:"month"`
+	Books int `json:"books"`
+}
+
+type NameCount struct {
+	Name  string `json:"name"`
+	Books int    `json:"books"`
+}
+
+// ReadingStats sums up what a user read in a year. Streaks count consecutive months with at least one
+// finished book and are worked out over all years.
+type ReadingStats struct {
+	Year           int          `json:"year"`
+	BooksFinished  int          `json:"books_finished"`
+	PerMonth       []MonthCount `json:"per_month"`
+	TopGenres      []NameCount  `json:"top_genres"`
+	TopAuthors     []NameCount  `json:"top_authors"`
+	ReviewsWritten int          `json:"reviews_written"`
+	AverageRating  *float64     `json:"average_rating"`
+	CurrentStreak  int          `json:"current_streak_months"`
+	LongestStreak  int          `json:"longest_streak_months"`
+	Goal           *ReadingGoal `json:"goal,omitempty"`
+}
+
+// --------------------------------------------------------------------------------------------------------------------
+// GetStats works out the user's reading stats for the year, now decides where the current streak ends
+func (m ReadingStatsModel) GetStats(userID int64, year int, now time.Time) (*ReadingStats, error) {
+	query := `
+		WITH ` + finishedBooksCTE + `
+		SELECT f.finished_at, b.genre, ARRAY_REMOVE(ARRAY_AGG(a.name), NULL)
+		FROM finished f
+		INNER JOIN books b ON b.id = f.book_id
+		LEFT JOIN book_authors ba ON ba.book_id = b.id
+		LEFT JOIN authors a ON a.id = ba.author_id
+		GROUP BY f.book_id, f.finished_at, b.genre
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := &ReadingStats{Year: year}
+	perMonth := make([]int, 12)
+	genres := make(map[string]int)
+	authors := make(map[string]int)
+	// months with a finished book, counted as year*12 + month so neighbouring months differ by one
+	activeMonths := make(map[int]bool)
+
+	for rows.Next() {
+		var finishedAt time.Time
+		var genre string
+		var bookAuthors []string
+		err := rows.Scan(&finishedAt, &genre, pq.Array(&bookAuthors))
+		if err != nil {
+			return nil, err
+		}
+
+		activeMonths[monthIndex(finishedAt)] = true
+		if finishedAt.Year() != year {
+			continue
+		}
+		stats.BooksFinished++
+		perMonth[finishedAt.Month()-1]++
+		if genre != "" {
+			genres[genre]++
+		}
+		for _, author := range bookAuthors {
+			authors[author]++
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i, books := range perMonth {
+		stats.PerMonth = append(stats.PerMonth, MonthCount{Month: i + 1, Books: books})
+	}
+	stats.TopGenres = topCounts(genres, statsTopCount)
+	stats.TopAuthors = topCounts(authors, statsTopCount)
+	stats.CurrentStreak, stats.LongestStreak = monthStreaks(activeMonths, monthIndex(now))
+
+	query = `
+		SELECT COUNT(*), AVG(rating)::float8
+		FROM reviews
+		WHERE user_id = $1 AND EXTRACT(YEAR FROM review_date) = $2
+	`
+	err = m.DB.QueryRowContext(ctx, query, userID, year).Scan(&stats.ReviewsWritten, &stats.AverageRating)
+	if err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+func monthIndex(t time.Time) int {
+	return t.Year()*12 + int(t.Month()) - 1
+}
+
+// topCounts returns the n names with the most books, ties are broken by name
+func topCounts(counts map[string]int, n int) []NameCount {
+	result := []NameCount{}
+	for name, books := range counts {
+		result = append(result, NameCount{Name: name, Books: books})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Books != result[j].Books {
+			return result[i].Books > result[j].Books
+		}
+		return result[i].Name < result[j].Name
+	})
+	if len(result) > n {
+		result = result[:n]
+	}
+	return result
+}
+
+// monthStreaks returns the run of active months ending at the current month, or the month before it since the
+// current month may not be over yet, and the longest run overall
+func monthStreaks(active map[int]bool, current int) (int, int) {
+	longest := 0
+	for month := range active {
+		// only start counting at the first month of a run
+		if active[month-1] {
+			continue
+		}
+		run := 0
+		for active[month+run] {
+			run++
+		}
+		if run > longest {
+			longest = run
+		}
+	}
+
+	end := current
+	if !active[end] {
+		end--
+	}
+	streak := 0
+	for active[end-streak] {
+		streak++
+	}
+
+	return streak, longest
+}
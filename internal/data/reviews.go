@@ -10,34 +10,69 @@ import (
 	"os"
 	"time"
 
+	"github.com/lib/pq"
 	"github.com/luigiacunaUB/cmps4191-test-3/internal/validator"
 )
 
+// DefaultReviewMaxLength is used when ReviewModel.MaxLength is not configured
+const DefaultReviewMaxLength = 10000
+
 type ReviewModel struct {
 	DB *sql.DB
+	// MaxLength is the longest review, in bytes of Markdown source, that ValidateReview accepts
+	MaxLength int
 }
 
 type Review struct {
-	ID     int64  `json:"reviewid"`
-	BookID int64  `json:"bookid"`
-	UserID int64  `json:"userid"`
-	Review string `json:"review"`
-	Rating int64  `json:"rating"`
+	ID         int64     `json:"reviewid"`
+	BookID     int64     `json:"bookid"`
+	UserID     int64     `json:"userid"` // 0 for reviews kept after the author deleted their account
+	Review     string    `json:"review"`
+	ReviewHTML string    `json:"review_html"`
+	Rating     int64     `json:"rating"`
+	ReviewDate time.Time `json:"review_date"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	// Edited is true once the review has at least one earlier revision
+	Edited bool `json:"edited"`
+	// Book is only filled in when reviews are listed outside of a single book
+	Book *ReviewBook `json:"book,omitempty"`
+}
+
+// ReviewBook is the short summary of a book embedded in a review
+type ReviewBook struct {
+	ID      int64    `json:"id"`
+	Title   string   `json:"title"`
+	Authors []string `json:"authors"`
+}
+
+// ReviewRevision is an earlier version of a review, kept whenever the review is updated
+type ReviewRevision struct {
+	ID         int64     `json:"id"`
+	ReviewID   int64     `json:"reviewid"`
+	Rating     int64     `json:"rating"`
+	Review     string    `json:"review"`
+	WrittenAt  time.Time `json:"written_at"`
+	ReplacedAt time.Time `json:"replaced_at"`
 }
 
 func ValidateReview(v *validator.Validator, r ReviewModel, review *Review) {
 	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
 	logger.Info("Inside ValidateReview")
-	//check if the review is less than 100 bytes long
+	//check the review is within the configured length
+	maxLength := r.MaxLength
+	if maxLength <= 0 {
+		maxLength = DefaultReviewMaxLength
+	}
 	v.Check(review.Review != "", "Review", "Must not be Empty")
-	v.Check(len(review.Review) <= 100, "Review", "Must not be more than 100 bytes long")
+	v.Check(len(review.Review) <= maxLength, "Review", fmt.Sprintf("Must not be more than %d bytes long", maxLength))
 	//Check Ratings is between 1 and 5
 	v.Check(review.Rating >= 1 && review.Rating <= 5, "Ratings", "Ratings must between 1 and 5")
 }
 
 func ValidateReviewIDOnly(v *validator.Validator, r ReviewModel, review *Review) {
 	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
-	logger.Info("ReviewID being sent: ", review.ID)
+	logger.Info("ReviewID being sent", "id", review.ID)
 	v.Check(review.ID >= 1, "ReviewID", "ReviewID cannot be less than 1 this one")
 }
 
@@ -45,16 +80,13 @@ func (r ReviewModel) AddBookReview(review Review) (Review, error) {
 
 	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
 	logger.Info("Inside AddBooReviewHandler")
-	logger.Info("UserID sent SQL:", review.UserID)
-	logger.Info("BookID sent SQL: ", review.BookID)
-	logger.Info("Review sent SQL:", review.Review)
-	logger.Info("Rating sent SQL:", review.Rating)
+	logger.Info("Review sent SQL", "userID", review.UserID, "bookID", review.BookID, "rating", review.Rating)
 
 	// SQL query to insert the review
 	query := `
-		INSERT INTO reviews (book_id, user_id, rating, review)
-		VALUES ($1, $2, $3, $4)
-		RETURNING id
+		INSERT INTO reviews (book_id, user_id, rating, review, review_html)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, review_date, created_at, updated_at
 	`
 
 	// Arguments for the query
@@ -63,6 +95,7 @@ func (r ReviewModel) AddBookReview(review Review) (Review, error) {
 		review.UserID,
 		review.Rating,
 		review.Review,
+		review.ReviewHTML,
 	}
 	// Context with timeout
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
@@ -70,7 +103,12 @@ func (r ReviewModel) AddBookReview(review Review) (Review, error) {
 
 	// Execute the query
 	var createdReview Review
-	err := r.DB.QueryRowContext(ctx, query, args...).Scan(&createdReview.ID)
+	err := r.DB.QueryRowContext(ctx, query, args...).Scan(
+		&createdReview.ID,
+		&createdReview.ReviewDate,
+		&createdReview.CreatedAt,
+		&createdReview.UpdatedAt,
+	)
 	if err != nil {
 		logger.Error("Error inserting review", "error", err)
 		return Review{}, err
@@ -81,6 +119,7 @@ func (r ReviewModel) AddBookReview(review Review) (Review, error) {
 	createdReview.UserID = review.UserID
 	createdReview.Rating = review.Rating
 	createdReview.Review = review.Review
+	createdReview.ReviewHTML = review.ReviewHTML
 
 	logger.Info("Successfully added review", "reviewID", createdReview.ID)
 	return createdReview, nil
@@ -91,30 +130,148 @@ func (r ReviewModel) AddBookReview(review Review) (Review, error) {
 func (r ReviewModel) UpdateReview(review Review) (Review, error) {
 	//workflow
 	//parameters recieved from review: reviewID, updated review, updated rating
-	//update the review
+	//keep the current version in review_revisions, then update the review
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return Review{}, err
+	}
+	defer tx.Rollback()
 
 	//EXECUTION
+	revisionQuery := `
+		INSERT INTO review_revisions (review_id, rating, review, written_at)
+		SELECT id, rating, review, updated_at
+		FROM reviews
+		WHERE id = $1
+	`
+	result, err := tx.ExecContext(ctx, revisionQuery, review.ID)
+	if err != nil {
+		return Review{}, fmt.Errorf("failed to save review revision: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return Review{}, err
+	}
+	if rowsAffected == 0 {
+		return Review{}, ErrRecordNotFound
+	}
+
 	updateQuery := `
 		UPDATE reviews 
-		SET rating = $1, review = $2, updated_at = CURRENT_TIMESTAMP 
-		WHERE id = $3 
-		RETURNING id, book_id, rating, review
+		SET rating = $1, review = $2, review_html = $3, updated_at = CURRENT_TIMESTAMP 
+		WHERE id = $4 
+		RETURNING id, book_id, COALESCE(user_id, 0), rating, review, review_html, review_date, created_at, updated_at
 	`
 	// Prepare variables to store the updated data
 	var updatedReview Review
 
 	// Execute the query and scan the updated values
-	err := r.DB.QueryRow(updateQuery, review.Rating, review.Review, review.ID).
-		Scan(&updatedReview.ID, &updatedReview.BookID, &updatedReview.Rating, &updatedReview.Review)
-
+	err = tx.QueryRowContext(ctx, updateQuery, review.Rating, review.Review, review.ReviewHTML, review.ID).Scan(
+		&updatedReview.ID,
+		&updatedReview.BookID,
+		&updatedReview.UserID,
+		&updatedReview.Rating,
+		&updatedReview.Review,
+		&updatedReview.ReviewHTML,
+		&updatedReview.ReviewDate,
+		&updatedReview.CreatedAt,
+		&updatedReview.UpdatedAt,
+	)
 	if err != nil {
 		return Review{}, fmt.Errorf("failed to update review: %w", err)
 	}
+	updatedReview.Edited = true
+
+	err = tx.Commit()
+	if err != nil {
+		return Review{}, err
+	}
 
 	// Return the updated review
 	return updatedReview, nil
 }
 
+// --------------------------------------------------------------------------------------------------------------------------------------
+func (r ReviewModel) Get(id int64) (Review, error) {
+	query := `
+		SELECT r.id, r.book_id, COALESCE(r.user_id, 0), r.rating, r.review, r.review_html, r.review_date, r.created_at, r.updated_at,
+		       EXISTS (SELECT 1 FROM review_revisions rr WHERE rr.review_id = r.id)
+		FROM reviews r
+		WHERE r.id = $1
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var review Review
+	err := r.DB.QueryRowContext(ctx, query, id).Scan(
+		&review.ID,
+		&review.BookID,
+		&review.UserID,
+		&review.Rating,
+		&review.Review,
+		&review.ReviewHTML,
+		&review.ReviewDate,
+		&review.CreatedAt,
+		&review.UpdatedAt,
+		&review.Edited,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return Review{}, ErrRecordNotFound
+		default:
+			return Review{}, err
+		}
+	}
+
+	return review, nil
+}
+
+// --------------------------------------------------------------------------------------------------------------------------------------
+func (r ReviewModel) GetRevisions(reviewID int64) ([]ReviewRevision, error) {
+	query := `
+		SELECT id, review_id, rating, review, written_at, replaced_at
+		FROM review_revisions
+		WHERE review_id = $1
+		ORDER BY replaced_at DESC, id DESC
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := r.DB.QueryContext(ctx, query, reviewID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []ReviewRevision{}
+	for rows.Next() {
+		var revision ReviewRevision
+		err := rows.Scan(
+			&revision.ID,
+			&revision.ReviewID,
+			&revision.Rating,
+			&revision.Review,
+			&revision.WrittenAt,
+			&revision.ReplacedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, revision)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return revisions, nil
+}
+
 func (r ReviewModel) CheckIfReviewExistForUser(bookid int64, userid int64) bool {
 	query := `SELECT book_id,user_id FROM reviews WHERE book_id=$1 AND user_id=$2`
 
@@ -143,10 +300,11 @@ func (r ReviewModel) CheckIfReviewExistForUser(bookid int64, userid int64) bool
 // ---------------------------------------------------------------------------------------------------------------------------
 func (r ReviewModel) ListAllReviews(bookID int64) ([]Review, error) {
 	query := `
-        SELECT id, book_id, user_id, rating, review
-        FROM reviews
-        WHERE book_id = $1
-        ORDER BY id
+        SELECT r.id, r.book_id, COALESCE(r.user_id, 0), r.rating, r.review, r.review_html, r.review_date, r.created_at, r.updated_at,
+               EXISTS (SELECT 1 FROM review_revisions rr WHERE rr.review_id = r.id)
+        FROM reviews r
+        WHERE r.book_id = $1
+        ORDER BY r.id
     `
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -170,6 +328,11 @@ func (r ReviewModel) ListAllReviews(bookID int64) ([]Review, error) {
 			&review.UserID,
 			&review.Rating,
 			&review.Review,
+			&review.ReviewHTML,
+			&review.ReviewDate,
+			&review.CreatedAt,
+			&review.UpdatedAt,
+			&review.Edited,
 		)
 		if err != nil {
 			return nil, err
@@ -194,7 +357,7 @@ func (r ReviewModel) DeleteReview(reviewID int64) (Review, error) {
 	deleteQuery := `
 		DELETE FROM reviews 
 		WHERE id = $1
-		RETURNING id, book_id, user_id, rating, review
+		RETURNING id, book_id, COALESCE(user_id, 0), rating, review, review_html, review_date, created_at, updated_at
 	`
 
 	// Prepare a variable to store the deleted review details
@@ -202,7 +365,8 @@ func (r ReviewModel) DeleteReview(reviewID int64) (Review, error) {
 
 	// Execute the query and scan the deleted values
 	err := r.DB.QueryRow(deleteQuery, reviewID).
-		Scan(&deletedReview.ID, &deletedReview.BookID, &deletedReview.UserID, &deletedReview.Rating, &deletedReview.Review)
+		Scan(&deletedReview.ID, &deletedReview.BookID, &deletedReview.UserID, &deletedReview.Rating, &deletedReview.Review,
+			&deletedReview.ReviewHTML, &deletedReview.ReviewDate, &deletedReview.CreatedAt, &deletedReview.UpdatedAt)
 
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -214,3 +378,66 @@ func (r ReviewModel) DeleteReview(reviewID int64) (Review, error) {
 	// Return the deleted review details
 	return deletedReview, nil
 }
+
+// ---------------------------------------------------------------------------------------------------------------------
+func (r ReviewModel) GetAllForUser(userID int64, filters Filters) ([]Review, MetaData, error) {
+	query := fmt.Sprintf(`
+		SELECT COUNT(*) OVER(), r.id, r.book_id, r.user_id, r.rating, r.review, r.review_html,
+		       r.review_date, r.created_at, r.updated_at,
+		       EXISTS (SELECT 1 FROM review_revisions rr WHERE rr.review_id = r.id),
+		       b.title, ARRAY_REMOVE(ARRAY_AGG(a.name), NULL) AS authors
+		FROM reviews r
+		INNER JOIN books b ON b.id = r.book_id
+		LEFT JOIN book_authors ba ON ba.book_id = b.id
+		LEFT JOIN authors a ON a.id = ba.author_id
+		WHERE r.user_id = $1
+		GROUP BY r.id, b.id
+		ORDER BY r.%s %s, r.id ASC
+		LIMIT $2 OFFSET $3
+	`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := r.DB.QueryContext(ctx, query, userID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, MetaData{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	reviews := []Review{}
+
+	for rows.Next() {
+		var review Review
+		var book ReviewBook
+		err := rows.Scan(
+			&totalRecords,
+			&review.ID,
+			&review.BookID,
+			&review.UserID,
+			&review.Rating,
+			&review.Review,
+			&review.ReviewHTML,
+			&review.ReviewDate,
+			&review.CreatedAt,
+			&review.UpdatedAt,
+			&review.Edited,
+			&book.Title,
+			pq.Array(&book.Authors),
+		)
+		if err != nil {
+			return nil, MetaData{}, err
+		}
+		book.ID = review.BookID
+		review.Book = &book
+		reviews = append(reviews, review)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, MetaData{}, err
+	}
+
+	metadata := calculateMetaData(totalRecords, filters.Page, filters.PageSize)
+	return reviews, metadata, nil
+}
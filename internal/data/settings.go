@@ -0,0 +1,64 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type SettingsModel struct {
+	DB *sql.DB
+}
+
+// Settings are the site wide settings admins change through the API
+type Settings struct {
+	// RequireTwoFactorForWriters refuses write requests from users without two-factor authentication enabled
+	RequireTwoFactorForWriters bool      `json:"require_2fa_for_writers"`
+	UpdatedAt                  time.Time `json:"updated_at"`
+	Version                    int       `json:"version"`
+}
+
+// --------------------------------------------------------------------------------------------------------------------------------------
+func (m SettingsModel) Get() (*Settings, error) {
+	query := `
+		SELECT require_2fa_for_writers, updated_at, version
+		FROM settings
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var settings Settings
+	err := m.DB.QueryRowContext(ctx, query).Scan(
+		&settings.RequireTwoFactorForWriters,
+		&settings.UpdatedAt,
+		&settings.Version,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &settings, nil
+}
+
+// --------------------------------------------------------------------------------------------------------------------------------------
+func (m SettingsModel) Update(settings *Settings) error {
+	query := `
+		UPDATE settings
+		SET require_2fa_for_writers = $1, updated_at = NOW(), version = version + 1
+		WHERE version = $2
+		RETURNING updated_at, version
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, settings.RequireTwoFactorForWriters, settings.Version).Scan(&settings.UpdatedAt, &settings.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
@@ -6,23 +6,54 @@ import (
 	"crypto/sha256"
 	"database/sql"
 	"encoding/base32"
+	"encoding/hex"
+	"errors"
 	"time"
 
 	"github.com/luigiacunaUB/cmps4191-test-3/internal/validator"
 )
 
-
 const ScopeActivation = "activation"
 const ScopeAuthentication = "authentication"
+const ScopePasswordReset = "password-reset"
+const ScopeEmailChange = "email-change"
+const ScopeRefresh = "refresh"
 
 type Token struct {
-	Plaintext string    `json:"token`
+	ID        int64     `json:"-"`
+	Plaintext string    `json:"token"`
 	Hash      []byte    `json:"-"`
 	UserID    int64     `json:"-"`
-	Expiry    time.Time `json: "expiry"`
+	Expiry    time.Time `json:"expiry"`
 	Scope     string    `json:"-"`
+	CreatedAt time.Time `json:"-"`
+	// FamilyID groups the access and refresh tokens issued for one login, 0 for tokens outside a session
+	FamilyID int64 `json:"-"`
+	// IPAddress and UserAgent describe the client an authentication token was issued to
+	IPAddress string `json:"-"`
+	UserAgent string `json:"-"`
+}
+
+// Session is one login as the user sees it: a token family with an unexpired, unused token. The tokens
+// themselves are never shown again.
+type Session struct {
+	ID         int64      `json:"id"` // the family id
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	Expiry     time.Time  `json:"expiry"`
+	IPAddress  string     `json:"ip_address"`
+	UserAgent  string     `json:"user_agent"`
+	// Current marks the session the request was made with
+	Current bool `json:"current"`
+	// tokenID is the access token a request was authenticated with
+	tokenID int64
 }
-//--------------------------------------------------------------------------------------------------------------------------------------
+
+// sessionTouchInterval is how stale last_used_at may get before a request updates it, so that every
+// authenticated request doesn't write to the tokens table
+const sessionTouchInterval = time.Minute
+
+// --------------------------------------------------------------------------------------------------------------------------------------
 func generateToken(userID int64, ttl time.Duration, scope string) (*Token, error) {
 	token := &Token{
 		UserID: userID,
@@ -40,16 +71,19 @@ func generateToken(userID int64, ttl time.Duration, scope string) (*Token, error
 
 	return token, nil
 }
-//------------------------------------------------------------------------------------------------------------------------------------
+
+// ------------------------------------------------------------------------------------------------------------------------------------
 func ValidateTokenPlaintext(v *validator.Validator, tokenPlaintext string) {
 	v.Check(tokenPlaintext != "", "token", "must be provided")
 	v.Check(len(tokenPlaintext) == 26, "token", "must be 26 bytes long")
 }
-//---------------------------------------------------------------------------------------------------------------------------------------
+
+// ---------------------------------------------------------------------------------------------------------------------------------------
 type TokenModel struct {
 	DB *sql.DB
 }
-//-------------------------------------------------------------------------------------------------------------------------------------
+
+// -------------------------------------------------------------------------------------------------------------------------------------
 func (t TokenModel) New(userID int64, ttl time.Duration, scope string) (*Token, error) {
 	token, err := generateToken(userID, ttl, scope)
 	if err != nil {
@@ -59,21 +93,150 @@ func (t TokenModel) New(userID int64, ttl time.Duration, scope string) (*Token,
 	err = t.Insert(token)
 	return token, err
 }
-//---------------------------------------------------------------------------------------------------------------------------------------
+
+// ---------------------------------------------------------------------------------------------------------------------------------------
 func (t TokenModel) Insert(token *Token) error {
-	query := `
-				INSERT INTO tokens (hash, user_id, expiry, scope) 
-				VALUES ($1, $2, $3, $4)
-			  `
-	args := []any{token.Hash, token.UserID, token.Expiry, token.Scope}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return t.DB.QueryRowContext(ctx, tokenInsertQuery, token.insertArgs()...).Scan(&token.ID, &token.CreatedAt)
+}
+
+const tokenInsertQuery = `
+	INSERT INTO tokens (hash, user_id, expiry, scope, ip_address, user_agent, family_id)
+	VALUES ($1, $2, $3, $4, NULLIF($5, ''), NULLIF($6, ''), NULLIF($7, 0))
+	RETURNING id, created_at
+`
 
+func (token *Token) insertArgs() []any {
+	return []any{token.Hash, token.UserID, token.Expiry, token.Scope, token.IPAddress, token.UserAgent, token.FamilyID}
+}
+
+// -------------------------------------------------------------------------------------------------------------------------------------
+// NewSession starts a token family for a login: a short-lived access token and the refresh token that is
+// exchanged for the next pair, both recording the client they were issued to
+func (t TokenModel) NewSession(userID int64, accessTTL, refreshTTL time.Duration, ipAddress, userAgent string) (*Token, *Token, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	_, err := t.DB.ExecContext(ctx, query, args...)
-	return err
+	tx, err := t.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	var familyID int64
+	err = tx.QueryRowContext(ctx, `SELECT nextval('token_families_seq')`).Scan(&familyID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	access, refresh, err := insertTokenPair(ctx, tx, userID, familyID, accessTTL, refreshTTL, ipAddress, userAgent)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, nil, err
+	}
+	return access, refresh, nil
+}
+
+// -------------------------------------------------------------------------------------------------------------------------------------
+// RotateRefreshToken exchanges an unused refresh token for a new access and refresh token in the same family.
+// A refresh token that was already exchanged means it has been copied, so the whole family is revoked and
+// ErrRefreshTokenReused is returned.
+func (t TokenModel) RotateRefreshToken(tokenPlaintext string, accessTTL, refreshTTL time.Duration, ipAddress, userAgent string) (*Token, *Token, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := t.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	// The row lock makes two requests racing with the same refresh token count as reuse
+	query := `
+		SELECT id, user_id, family_id, expiry, used_at
+		FROM tokens
+		WHERE hash = $1 AND scope = $2
+		FOR UPDATE
+	`
+	var old Token
+	var usedAt *time.Time
+	err = tx.QueryRowContext(ctx, query, tokenHash[:], ScopeRefresh).Scan(&old.ID, &old.UserID, &old.FamilyID, &old.Expiry, &usedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, nil, ErrRecordNotFound
+		default:
+			return nil, nil, err
+		}
+	}
+
+	if usedAt != nil {
+		_, err = tx.ExecContext(ctx, `DELETE FROM tokens WHERE family_id = $1`, old.FamilyID)
+		if err != nil {
+			return nil, nil, err
+		}
+		err = tx.Commit()
+		if err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, ErrRefreshTokenReused
+	}
+	now := time.Now()
+	if !old.Expiry.After(now) {
+		return nil, nil, ErrRecordNotFound
+	}
+
+	// Used refresh tokens are kept until they expire so that reuse can be recognised
+	_, err = tx.ExecContext(ctx, `UPDATE tokens SET used_at = $1, last_used_at = $1 WHERE id = $2`, now, old.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	access, refresh, err := insertTokenPair(ctx, tx, old.UserID, old.FamilyID, accessTTL, refreshTTL, ipAddress, userAgent)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, nil, err
+	}
+	return access, refresh, nil
+}
+
+// insertTokenPair issues an access token and a refresh token in the given family
+func insertTokenPair(ctx context.Context, tx *sql.Tx, userID, familyID int64, accessTTL, refreshTTL time.Duration, ipAddress, userAgent string) (*Token, *Token, error) {
+	access, err := generateToken(userID, accessTTL, ScopeAuthentication)
+	if err != nil {
+		return nil, nil, err
+	}
+	refresh, err := generateToken(userID, refreshTTL, ScopeRefresh)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, token := range []*Token{access, refresh} {
+		token.FamilyID = familyID
+		token.IPAddress = ipAddress
+		token.UserAgent = userAgent
+		err = tx.QueryRowContext(ctx, tokenInsertQuery, token.insertArgs()...).Scan(&token.ID, &token.CreatedAt)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return access, refresh, nil
 }
-//---------------------------------------------------------------------------------------------------------------------------------------
+
+// ---------------------------------------------------------------------------------------------------------------------------------------
 func (t TokenModel) DeleteAllForUser(scope string, userID int64) error {
 	query := `
 						DELETE FROM tokens 
@@ -86,3 +249,149 @@ func (t TokenModel) DeleteAllForUser(scope string, userID int64) error {
 	return err
 
 }
+
+// ---------------------------------------------------------------------------------------------------------------------------------------
+// GetSessionsForUser returns the user's logins that still have a usable token, the most recently used first.
+// The IP address is where the family was last used from and the user agent is the one that logged in.
+func (t TokenModel) GetSessionsForUser(userID int64) ([]Session, error) {
+	query := `
+		SELECT family_id, MIN(created_at), MAX(last_used_at), MAX(expiry),
+		       (ARRAY_AGG(COALESCE(ip_address, '') ORDER BY COALESCE(last_used_at, created_at) DESC))[1],
+		       (ARRAY_AGG(COALESCE(user_agent, '') ORDER BY created_at ASC, id ASC))[1]
+		FROM tokens
+		WHERE user_id = $1 AND scope IN ($2, $3) AND family_id IS NOT NULL
+		GROUP BY family_id
+		HAVING BOOL_OR(expiry > $4 AND used_at IS NULL)
+		ORDER BY MAX(COALESCE(last_used_at, created_at)) DESC, family_id DESC
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := t.DB.QueryContext(ctx, query, userID, ScopeAuthentication, ScopeRefresh, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []Session{}
+	for rows.Next() {
+		var session Session
+		err := rows.Scan(
+			&session.ID,
+			&session.CreatedAt,
+			&session.LastUsedAt,
+			&session.Expiry,
+			&session.IPAddress,
+			&session.UserAgent,
+		)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// ---------------------------------------------------------------------------------------------------------------------------------------
+// DeleteSession revokes one of the user's logins, every access and refresh token in the family goes
+func (t TokenModel) DeleteSession(familyID, userID int64) error {
+	query := `
+		DELETE FROM tokens
+		WHERE family_id = $1 AND user_id = $2 AND scope IN ($3, $4)
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := t.DB.ExecContext(ctx, query, familyID, userID, ScopeAuthentication, ScopeRefresh)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// ---------------------------------------------------------------------------------------------------------------------------------------
+// TouchSession records that the session was just used from ipAddress. Sessions used within the last
+// sessionTouchInterval are left alone.
+func (t TokenModel) TouchSession(session Session, ipAddress string) error {
+	now := time.Now()
+	if session.LastUsedAt != nil && now.Sub(*session.LastUsedAt) < sessionTouchInterval && session.IPAddress == ipAddress {
+		return nil
+	}
+
+	query := `
+		UPDATE tokens
+		SET last_used_at = $1, ip_address = NULLIF($2, '')
+		WHERE id = $3
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := t.DB.ExecContext(ctx, query, now, ipAddress, session.tokenID)
+	return err
+}
+
+// ---------------------------------------------------------------------------------------------------------------------------------------
+// DeleteSessionsForUser logs the user out everywhere by removing all of their access and refresh tokens
+func (t TokenModel) DeleteSessionsForUser(userID int64) error {
+	query := `
+		DELETE FROM tokens
+		WHERE user_id = $1 AND scope IN ($2, $3)
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := t.DB.ExecContext(ctx, query, userID, ScopeAuthentication, ScopeRefresh)
+	return err
+}
+
+// ---------------------------------------------------------------------------------------------------------------------------------------
+// GetRevokedTokens returns the hashes of access tokens deleted before they expired, keyed by hex encoded hash.
+// The revoked_tokens table is filled by a trigger whenever an unexpired authentication token is deleted.
+func (t TokenModel) GetRevokedTokens() (map[string]time.Time, error) {
+	query := `
+		SELECT hash, expiry
+		FROM revoked_tokens
+		WHERE expiry > $1
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := t.DB.QueryContext(ctx, query, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revoked := make(map[string]time.Time)
+	for rows.Next() {
+		var hash []byte
+		var expiry time.Time
+		err := rows.Scan(&hash, &expiry)
+		if err != nil {
+			return nil, err
+		}
+		revoked[hex.EncodeToString(hash)] = expiry
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return revoked, nil
+}
+
+// HashTokenPlaintext returns the hex encoded hash stored for a token, the form GetRevokedTokens uses
+func HashTokenPlaintext(tokenPlaintext string) string {
+	hash := sha256.Sum256([]byte(tokenPlaintext))
+	return hex.EncodeToString(hash[:])
+}
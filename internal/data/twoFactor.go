@@ -0,0 +1,336 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+)
+
+// ScopeTwoFactor is the short-lived token a password login returns when the user still owes a TOTP code
+const ScopeTwoFactor = "2fa-challenge"
+
+// RecoveryCodeCount is how many one-time recovery codes a user gets at a time
+const RecoveryCodeCount = 10
+
+const (
+	// TwoFactorMaxFailures is how many wrong codes in a row lock the second factor
+	TwoFactorMaxFailures = 5
+	// TwoFactorLockout is how long the first lock lasts, it doubles with every wrong code after that up
+	// to 64 times as long
+	TwoFactorLockout = 5 * time.Minute
+)
+
+type TwoFactorModel struct {
+	DB *sql.DB
+}
+
+// TwoFactor is a user's TOTP enrollment, it only guards logins once EnabledAt is set
+type TwoFactor struct {
+	UserID       int64      `json:"-"`
+	Secret       string     `json:"-"`
+	CreatedAt    time.Time  `json:"created_at"`
+	EnabledAt    *time.Time `json:"enabled_at"`
+	LastUsedStep int64      `json:"-"`
+	// FailedAttempts counts wrong codes since the last right one, LockedUntil is set once there are too many
+	FailedAttempts int        `json:"-"`
+	LockedUntil    *time.Time `json:"-"`
+}
+
+// Locked reports whether codes are refused at the moment
+func (t *TwoFactor) Locked() bool {
+	return t.LockedUntil != nil && time.Now().Before(*t.LockedUntil)
+}
+
+// --------------------------------------------------------------------------------------------------------------------------------------
+func (m TwoFactorModel) Get(userID int64) (*TwoFactor, error) {
+	query := `
+		SELECT user_id, secret, created_at, enabled_at, last_used_step, failed_attempts, locked_until
+		FROM user_totp
+		WHERE user_id = $1
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var twoFactor TwoFactor
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(
+		&twoFactor.UserID,
+		&twoFactor.Secret,
+		&twoFactor.CreatedAt,
+		&twoFactor.EnabledAt,
+		&twoFactor.LastUsedStep,
+		&twoFactor.FailedAttempts,
+		&twoFactor.LockedUntil,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &twoFactor, nil
+}
+
+// --------------------------------------------------------------------------------------------------------------------------------------
+// IsEnabled reports whether logins of the user need a TOTP code
+func (m TwoFactorModel) IsEnabled(userID int64) (bool, error) {
+	query := `
+		SELECT EXISTS (SELECT 1 FROM user_totp WHERE user_id = $1 AND enabled_at IS NOT NULL)
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var enabled bool
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(&enabled)
+	return enabled, err
+}
+
+// --------------------------------------------------------------------------------------------------------------------------------------
+// StartEnrollment saves a new secret for the user to confirm. Starting over replaces an unconfirmed secret,
+// an enabled one has to be disabled first.
+func (m TwoFactorModel) StartEnrollment(userID int64, secret string) error {
+	query := `
+		INSERT INTO user_totp (user_id, secret)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET secret = EXCLUDED.secret, created_at = NOW(), last_used_step = 0
+		WHERE user_totp.enabled_at IS NULL
+		RETURNING user_id
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, userID, secret).Scan(&userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrTwoFactorEnabled
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// --------------------------------------------------------------------------------------------------------------------------------------
+// Enable turns 2FA on after the user proved their authenticator works with a code from step, and returns the
+// recovery codes. They are only stored hashed, so this is the one time they can be shown.
+func (m TwoFactorModel) Enable(userID, step int64) ([]string, error) {
+	query := `
+		UPDATE user_totp
+		SET enabled_at = NOW(), last_used_step = $2
+		WHERE user_id = $1 AND enabled_at IS NULL AND last_used_step < $2
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, query, userID, step)
+	if err != nil {
+		return nil, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if rowsAffected == 0 {
+		return nil, ErrRecordNotFound
+	}
+
+	codes, err := replaceRecoveryCodes(ctx, tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return codes, tx.Commit()
+}
+
+// --------------------------------------------------------------------------------------------------------------------------------------
+// UseStep records that a code from step was accepted. It reports false when a code from that step or a later
+// one was already used, which stops a code seen over someone's shoulder from working a second time.
+func (m TwoFactorModel) UseStep(userID, step int64) (bool, error) {
+	query := `
+		UPDATE user_totp
+		SET last_used_step = $2
+		WHERE user_id = $1 AND enabled_at IS NOT NULL AND last_used_step < $2
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID, step)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected == 1, nil
+}
+
+// --------------------------------------------------------------------------------------------------------------------------------------
+// UseRecoveryCode spends one of the user's recovery codes, it reports false for unknown or used codes
+func (m TwoFactorModel) UseRecoveryCode(userID int64, code string) (bool, error) {
+	query := `
+		UPDATE totp_recovery_codes
+		SET used_at = NOW()
+		WHERE user_id = $1 AND hash = $2 AND used_at IS NULL
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID, hashRecoveryCode(code))
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected == 1, nil
+}
+
+// --------------------------------------------------------------------------------------------------------------------------------------
+// RecordFailure counts a wrong code. From the TwoFactorMaxFailures-th one on every wrong code locks the second
+// factor again, for twice as long as the one before.
+func (m TwoFactorModel) RecordFailure(userID int64) error {
+	query := `
+		UPDATE user_totp
+		SET failed_attempts = failed_attempts + 1,
+			locked_until = CASE
+				WHEN failed_attempts + 1 >= $2
+				THEN NOW() + make_interval(secs => $3 * POWER(2, LEAST(failed_attempts + 1 - $2, 6)))
+				ELSE locked_until
+			END
+		WHERE user_id = $1
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID, TwoFactorMaxFailures, TwoFactorLockout.Seconds())
+	return err
+}
+
+// --------------------------------------------------------------------------------------------------------------------------------------
+// ResetFailures forgets the wrong codes once a right one was entered
+func (m TwoFactorModel) ResetFailures(userID int64) error {
+	query := `
+		UPDATE user_totp
+		SET failed_attempts = 0, locked_until = NULL
+		WHERE user_id = $1 AND (failed_attempts > 0 OR locked_until IS NOT NULL)
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID)
+	return err
+}
+
+// --------------------------------------------------------------------------------------------------------------------------------------
+// RegenerateRecoveryCodes replaces every recovery code of the user, used or not, with a new set
+func (m TwoFactorModel) RegenerateRecoveryCodes(userID int64) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	codes, err := replaceRecoveryCodes(ctx, tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return codes, tx.Commit()
+}
+
+// --------------------------------------------------------------------------------------------------------------------------------------
+// RemainingRecoveryCodes counts the recovery codes the user has not used yet
+func (m TwoFactorModel) RemainingRecoveryCodes(userID int64) (int, error) {
+	query := `
+		SELECT COUNT(*) FROM totp_recovery_codes
+		WHERE user_id = $1 AND used_at IS NULL
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var remaining int
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(&remaining)
+	return remaining, err
+}
+
+// --------------------------------------------------------------------------------------------------------------------------------------
+// Disable removes the user's secret and recovery codes
+func (m TwoFactorModel) Disable(userID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM totp_recovery_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+	result, err := tx.ExecContext(ctx, `DELETE FROM user_totp WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return tx.Commit()
+}
+
+// replaceRecoveryCodes deletes the user's recovery codes and stores RecoveryCodeCount new ones
+func replaceRecoveryCodes(ctx context.Context, tx *sql.Tx, userID int64) ([]string, error) {
+	_, err := tx.ExecContext(ctx, `DELETE FROM totp_recovery_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, RecoveryCodeCount)
+	for range RecoveryCodeCount {
+		randomBytes := make([]byte, 10)
+		_, err := rand.Read(randomBytes)
+		if err != nil {
+			return nil, err
+		}
+		// 16 base32 characters shown as xxxxxxxx-xxxxxxxx
+		encoded := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes))
+		code := encoded[:8] + "-" + encoded[8:]
+
+		_, err = tx.ExecContext(ctx, `INSERT INTO totp_recovery_codes (user_id, hash) VALUES ($1, $2)`, userID, hashRecoveryCode(code))
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// hashRecoveryCode ignores case, spaces and dashes so a code typed from a printout still matches
+func hashRecoveryCode(code string) []byte {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	hash := sha256.Sum256([]byte(normalized))
+	return hash[:]
+}
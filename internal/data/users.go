@@ -22,7 +22,13 @@ type User struct {
 	Email     string    `json:"email"`
 	Password  password  `json:"-"`
 	Activated bool      `json:"activated"`
-	Version   int       `json:"-"`
+	Version   int       `json:"version"`
+	// ReviewsPrivate hides the user's reviews from the per-user review listing
+	ReviewsPrivate bool `json:"reviews_private"`
+	// NotifyListUpdates sends an email when a book is added to a list the user follows
+	NotifyListUpdates bool `json:"notify_list_updates"`
+	// PendingEmail is a new address the user asked for that has not been confirmed yet
+	PendingEmail *string `json:"pending_email,omitempty"`
 }
 
 type password struct {
@@ -62,7 +68,8 @@ func (u UserModel) Insert(user *User) error {
 // --------------------------------------------------------------------------------------------------------------------------------------
 func (u UserModel) GetByEmail(email string) (*User, error) {
 	query := `
-       SELECT id, created_at, username, email, password_hash, activated, version
+       SELECT id, created_at, username, email, password_hash, activated, version, reviews_private, notify_list_updates,
+              pending_email
        FROM users
        WHERE email = $1
       `
@@ -79,6 +86,9 @@ func (u UserModel) GetByEmail(email string) (*User, error) {
 		&user.Password.hash,
 		&user.Activated,
 		&user.Version,
+		&user.ReviewsPrivate,
+		&user.NotifyListUpdates,
+		&user.PendingEmail,
 	)
 
 	if err != nil {
@@ -155,8 +165,9 @@ func (u UserModel) Update(user *User) error {
 	query := `
         UPDATE users 
         SET username = $1, email = $2, password_hash = $3,
-            activated = $4, version = version + 1
-        WHERE id = $5 AND version = $6
+            activated = $4, reviews_private = $5, notify_list_updates = $6,
+            pending_email = $7, version = version + 1
+        WHERE id = $8 AND version = $9
         RETURNING version
         `
 
@@ -165,6 +176,9 @@ func (u UserModel) Update(user *User) error {
 		user.Email,
 		user.Password.hash,
 		user.Activated,
+		user.ReviewsPrivate,
+		user.NotifyListUpdates,
+		user.PendingEmail,
 		user.ID,
 		user.Version,
 	}
@@ -176,8 +190,7 @@ func (u UserModel) Update(user *User) error {
 
 	if err != nil {
 		switch {
-		case err.Error() == `pq: duplicate key value violates 
-									 unique constraint "users_email_key"`:
+		case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`:
 			return ErrDuplicateEmail
 		case errors.Is(err, sql.ErrNoRows):
 			return ErrEditConflict
@@ -195,7 +208,8 @@ func (u UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error)
 	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
 	query := `
         SELECT users.id, users.created_at, users.username,
-               users.email, users.password_hash, users.activated, users.version
+               users.email, users.password_hash, users.activated, users.version,
+               users.reviews_private, users.notify_list_updates, users.pending_email
         FROM users
         INNER JOIN tokens
         ON users.id = tokens.user_id
@@ -215,6 +229,9 @@ func (u UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error)
 		&user.Password.hash,
 		&user.Activated,
 		&user.Version,
+		&user.ReviewsPrivate,
+		&user.NotifyListUpdates,
+		&user.PendingEmail,
 	)
 	if err != nil {
 		switch {
@@ -227,6 +244,96 @@ func (u UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error)
 	return &user, nil
 }
 
+// --------------------------------------------------------------------------------------------------------------------------------------
+// GetForSession looks up the user of an authentication token along with the session the token belongs to
+func (u UserModel) GetForSession(tokenPlaintext string) (*User, Session, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+	query := `
+        SELECT users.id, users.created_at, users.username,
+               users.email, users.password_hash, users.activated, users.version,
+               users.reviews_private, users.notify_list_updates, users.pending_email,
+               tokens.id, tokens.family_id, tokens.created_at, tokens.last_used_at, tokens.expiry,
+               COALESCE(tokens.ip_address, ''), COALESCE(tokens.user_agent, '')
+        FROM users
+        INNER JOIN tokens
+        ON users.id = tokens.user_id
+        WHERE tokens.hash = $1
+        AND tokens.scope = $2 
+        AND tokens.expiry > $3
+       `
+	args := []any{tokenHash[:], ScopeAuthentication, time.Now()}
+	var user User
+	var session Session
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := u.DB.QueryRowContext(ctx, query, args...).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Username,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.Version,
+		&user.ReviewsPrivate,
+		&user.NotifyListUpdates,
+		&user.PendingEmail,
+		&session.tokenID,
+		&session.ID,
+		&session.CreatedAt,
+		&session.LastUsedAt,
+		&session.Expiry,
+		&session.IPAddress,
+		&session.UserAgent,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, Session{}, ErrRecordNotFound
+		default:
+			return nil, Session{}, err
+		}
+	}
+	session.Current = true
+	return &user, session, nil
+}
+
+// --------------------------------------------------------------------------------------------------------------------------------------
+func (u UserModel) Get(id int64) (*User, error) {
+	query := `
+       SELECT id, created_at, username, email, password_hash, activated, version, reviews_private, notify_list_updates,
+              pending_email
+       FROM users
+       WHERE id = $1
+      `
+	var user User
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := u.DB.QueryRowContext(ctx, query, id).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Username,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.Version,
+		&user.ReviewsPrivate,
+		&user.NotifyListUpdates,
+		&user.PendingEmail,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &user, nil
+}
+
 // --------------------------------------------------------------------------------------------------------------------------------------
 func (u *User) IsAnonymous() bool {
 	return u == AnonymousUser
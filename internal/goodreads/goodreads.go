@@ -0,0 +1,265 @@
+// Package goodreads reads and writes the CSV files produced by Goodreads' "Export Library" tool.
+package goodreads
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DateLayout is how Goodreads writes the Date Read and Date Added columns
+const DateLayout = "2006/01/02"
+
+// the exclusive shelves every Goodreads book is on exactly one of
+const (
+	ShelfRead             = "read"
+	ShelfCurrentlyReading = "currently-reading"
+	ShelfToRead           = "to-read"
+)
+
+// Header is the column order of a Goodreads library export
+var Header = []string{
+	"Book Id", "Title", "Author", "Author l-f", "Additional Authors", "ISBN", "ISBN13", "My Rating",
+	"Average Rating", "Publisher", "Binding", "Number of Pages", "Year Published", "Original Publication Year",
+	"Date Read", "Date Added", "Bookshelves", "Bookshelves with positions", "Exclusive Shelf", "My Review",
+	"Spoiler", "Private Notes", "Read Count", "Owned Copies",
+}
+
+var ErrMissingColumn = errors.New("the file is not a Goodreads library export")
+
+// Row is one book of a library export, Line is the line of the file it came from
+type Row struct {
+	Line              int
+	BookID            string
+	Title             string
+	Author            string
+	AdditionalAuthors []string
+	ISBN              string
+	ISBN13            string
+	MyRating          int
+	AverageRating     float64
+	YearPublished     int
+	DateRead          *time.Time
+	DateAdded         *time.Time
+	Shelves           []string
+	ExclusiveShelf    string
+	MyReview          string
+}
+
+// Authors returns the main author followed by any additional authors
+func (r Row) Authors() []string {
+	var authors []string
+	if r.Author != "" {
+		authors = append(authors, r.Author)
+	}
+	return append(authors, r.AdditionalAuthors...)
+}
+
+// ISBNs returns the row's ISBNs, 13 digit first, leaving out empty ones
+func (r Row) ISBNs() []string {
+	var isbns []string
+	for _, isbn := range []string{r.ISBN13, r.ISBN} {
+		if isbn != "" {
+			isbns = append(isbns, isbn)
+		}
+	}
+	return isbns
+}
+
+// seriesRX matches the series Goodreads appends to titles, as in "Catching Fire (The Hunger Games, #2)"
+var seriesRX = regexp.MustCompile(`\s*\([^()]*#[\d.]+\)$`)
+
+// ShortTitle returns the title without the series suffix
+func (r Row) ShortTitle() string {
+	return seriesRX.ReplaceAllString(r.Title, "")
+}
+
+// AllShelves returns the exclusive shelf followed by the other shelves the book is on, each once
+func (r Row) AllShelves() []string {
+	seen := make(map[string]bool)
+	var shelves []string
+	for _, shelf := range append([]string{r.ExclusiveShelf}, r.Shelves...) {
+		if shelf != "" && !seen[shelf] {
+			seen[shelf] = true
+			shelves = append(shelves, shelf)
+		}
+	}
+	return shelves
+}
+
+// --------------------------------------------------------------------------------------------------------------------
+// Read parses a library export. Columns are found by their header so files with extra or reordered columns still
+// load; only Title is required.
+func Read(r io.Reader) ([]Row, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, ErrMissingColumn
+		}
+		return nil, err
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.TrimPrefix(name, "\ufeff")
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["title"]; !ok {
+		return nil, ErrMissingColumn
+	}
+
+	var rows []Row
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		get := func(name string) string {
+			i, ok := columns[strings.ToLower(name)]
+			if !ok || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+
+		row := Row{
+			Line:              line,
+			BookID:            get("Book Id"),
+			Title:             get("Title"),
+			Author:            get("Author"),
+			AdditionalAuthors: splitList(get("Additional Authors")),
+			ISBN:              cleanISBN(get("ISBN")),
+			ISBN13:            cleanISBN(get("ISBN13")),
+			MyRating:          atoi(get("My Rating")),
+			AverageRating:     atof(get("Average Rating")),
+			YearPublished:     atoi(get("Year Published")),
+			DateRead:          parseDate(get("Date Read")),
+			DateAdded:         parseDate(get("Date Added")),
+			Shelves:           splitList(get("Bookshelves")),
+			ExclusiveShelf:    get("Exclusive Shelf"),
+			MyReview:          get("My Review"),
+		}
+		if row.YearPublished == 0 {
+			row.YearPublished = atoi(get("Original Publication Year"))
+		}
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+// --------------------------------------------------------------------------------------------------------------------
+// Write writes the rows as a library export that Goodreads and other sites can import
+func Write(w io.Writer, rows []Row) error {
+	writer := csv.NewWriter(w)
+	err := writer.Write(Header)
+	if err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		record := make([]string, len(Header))
+		record[0] = row.BookID
+		record[1] = row.Title
+		record[2] = row.Author
+		record[3] = lastFirst(row.Author)
+		record[4] = strings.Join(row.AdditionalAuthors, ", ")
+		record[5] = quoteISBN(row.ISBN)
+		record[6] = quoteISBN(row.ISBN13)
+		record[7] = strconv.Itoa(row.MyRating)
+		record[8] = fmt.Sprintf("%.2f", row.AverageRating)
+		if row.YearPublished > 0 {
+			record[12] = strconv.Itoa(row.YearPublished)
+		}
+		record[14] = formatDate(row.DateRead)
+		record[15] = formatDate(row.DateAdded)
+		record[16] = strings.Join(row.Shelves, ", ")
+		record[18] = row.ExclusiveShelf
+		record[19] = row.MyReview
+		record[22] = "0"
+		if row.ExclusiveShelf == ShelfRead {
+			record[22] = "1"
+		}
+		record[23] = "0"
+
+		err = writer.Write(record)
+		if err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// cleanISBN turns Goodreads' ="0439023483" into 0439023483
+func cleanISBN(value string) string {
+	var isbn strings.Builder
+	for _, char := range strings.ToUpper(value) {
+		if (char >= '0' && char <= '9') || char == 'X' {
+			isbn.WriteRune(char)
+		}
+	}
+	return isbn.String()
+}
+
+// quoteISBN writes an ISBN the way Goodreads does, so spreadsheets don't drop leading zeros
+func quoteISBN(isbn string) string {
+	return `="` + isbn + `"`
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func lastFirst(name string) string {
+	i := strings.LastIndex(name, " ")
+	if i < 0 {
+		return name
+	}
+	return name[i+1:] + ", " + name[:i]
+}
+
+func atoi(value string) int {
+	n, _ := strconv.Atoi(value)
+	return n
+}
+
+func atof(value string) float64 {
+	f, _ := strconv.ParseFloat(value, 64)
+	return f
+}
+
+func parseDate(value string) *time.Time {
+	t, err := time.Parse(DateLayout, value)
+	if err != nil {
+		return nil
+	}
+	return &t
+}
+
+func formatDate(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(DateLayout)
+}
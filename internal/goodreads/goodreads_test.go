@@ -0,0 +1,130 @@
+package goodreads
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const export = "\ufeffBook Id,Title,Author,Author l-f,Additional Authors,ISBN,ISBN13,My Rating,Average Rating,Publisher,Binding,Number of Pages,Year Published,Original Publication Year,Date Read,Date Added,Bookshelves,Bookshelves with positions,Exclusive Shelf,My Review,Spoiler,Private Notes,Read Count,Owned Copies\n" +
+	`2767052,"The Hunger Games (The Hunger Games, #1)",Suzanne Collins,"Collins, Suzanne",,"=""0439023483""","=""9780439023481""",5,4.33,Scholastic,Hardcover,374,2008,2008,2020/01/05,2019/12/24,"favourites, dystopia","favourites (#1)",read,"Loved it<br/>Really",,,1,0` + "\n" +
+	`6148028,Catching Fire,Suzanne Collins,"Collins, Suzanne","Someone Else, Another",,,0,4.30,,,,,2009,,2021/03/01,,,currently-reading,,,,0,0` + "\n" +
+	`1,Short Row` + "\n"
+
+func TestRead(t *testing.T) {
+	rows, err := Read(strings.NewReader(export))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("got %d rows, want 3", len(rows))
+	}
+
+	first := rows[0]
+	tests := []struct {
+		name string
+		got  any
+		want any
+	}{
+		{"line", first.Line, 2},
+		{"isbn", first.ISBN, "0439023483"},
+		{"isbn13", first.ISBN13, "9780439023481"},
+		{"rating", first.MyRating, 5},
+		{"average rating", first.AverageRating, 4.33},
+		{"year", first.YearPublished, 2008},
+		{"date read", *first.DateRead, time.Date(2020, 1, 5, 0, 0, 0, 0, time.UTC)},
+		{"shelves", first.Shelves, []string{"favourites", "dystopia"}},
+		{"exclusive shelf", first.ExclusiveShelf, ShelfRead},
+		{"review", first.MyReview, "Loved it<br/>Really"},
+		{"isbns", first.ISBNs(), []string{"9780439023481", "0439023483"}},
+		{"short title", first.ShortTitle(), "The Hunger Games"},
+		{"all shelves", first.AllShelves(), []string{"read", "favourites", "dystopia"}},
+		{"original year fallback", rows[1].YearPublished, 2009},
+		{"no date read", rows[1].DateRead, (*time.Time)(nil)},
+		{"authors", rows[1].Authors(), []string{"Suzanne Collins", "Someone Else", "Another"}},
+		{"untouched title", rows[1].ShortTitle(), "Catching Fire"},
+		{"short row title", rows[2].Title, "Short Row"},
+		{"short row shelves", rows[2].AllShelves(), []string(nil)},
+	}
+	for _, tt := range tests {
+		if !reflect.DeepEqual(tt.got, tt.want) {
+			t.Errorf("%s = %#v, want %#v", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestReadRejectsOtherFiles(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+	}{
+		{"empty", ""},
+		{"no title column", "name,author\nx,y\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Read(strings.NewReader(tt.file))
+			if !errors.Is(err, ErrMissingColumn) {
+				t.Errorf("err = %v, want ErrMissingColumn", err)
+			}
+		})
+	}
+}
+
+func TestReadReorderedColumns(t *testing.T) {
+	rows, err := Read(strings.NewReader("My Rating, title ,Extra\n3,Dune,x\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0].Title != "Dune" || rows[0].MyRating != 3 {
+		t.Errorf("rows = %+v", rows)
+	}
+}
+
+func TestWriteReadsBack(t *testing.T) {
+	read := time.Date(2023, 7, 14, 0, 0, 0, 0, time.UTC)
+	rows := []Row{
+		{
+			BookID:            "7",
+			Title:             "Dune",
+			Author:            "Frank Herbert",
+			AdditionalAuthors: []string{"Brian Herbert"},
+			ISBN:              "0441013597",
+			MyRating:          4,
+			AverageRating:     4.25,
+			YearPublished:     1965,
+			DateRead:          &read,
+			Shelves:           []string{"sci-fi", "classics"},
+			ExclusiveShelf:    ShelfRead,
+			MyReview:          "Spice, with a comma",
+		},
+		{BookID: "8", Title: "Unread", ExclusiveShelf: ShelfToRead},
+	}
+
+	var file bytes.Buffer
+	err := Write(&file, rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(file.String(), `"Herbert, Frank"`) || !strings.Contains(file.String(), `"=""0441013597"""`) {
+		t.Errorf("unexpected file:\n%s", file.String())
+	}
+
+	got, err := Read(&file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(rows) {
+		t.Fatalf("got %d rows back, want %d", len(got), len(rows))
+	}
+	for i := range rows {
+		want := rows[i]
+		want.Line = i + 2
+		if !reflect.DeepEqual(got[i], want) {
+			t.Errorf("row %d\n got  %+v\n want %+v", i, got[i], want)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+// Package jwtauth signs and verifies the HS256 JSON Web Tokens used as access tokens in the stateless
+// authentication mode. Keys are identified by the kid header so they can be rotated without logging everyone out.
+package jwtauth
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// MinKeyLength is the shortest secret accepted for HS256
+const MinKeyLength = 32
+
+var ErrInvalidToken = errors.New("invalid or expired token")
+
+// Claims is what an access token says about its user. The permissions are the ones the user had when the
+// token was issued, changes only show up in the next token.
+type Claims struct {
+	Username    string   `json:"username"`
+	Activated   bool     `json:"activated"`
+	Permissions []string `json:"permissions"`
+	// SessionID is the token family the access token belongs to
+	SessionID int64 `json:"sid,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// UserID returns the user id held in the subject claim
+func (c *Claims) UserID() (int64, error) {
+	id, err := strconv.ParseInt(c.Subject, 10, 64)
+	if err != nil || id < 1 {
+		return 0, ErrInvalidToken
+	}
+	return id, nil
+}
+
+// KeySet holds the secrets tokens are signed with. New tokens are signed with the first key, every key is
+// accepted when verifying, so a retired key can stay in the set until the tokens it signed have expired.
+type KeySet struct {
+	issuer     string
+	signingKID string
+	keys       map[string][]byte
+}
+
+// ParseKeySet reads keys written as "kid:secret,kid:secret", the first one signs new tokens
+func ParseKeySet(spec, issuer string) (*KeySet, error) {
+	set := &KeySet{issuer: issuer, keys: make(map[string][]byte)}
+
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		kid, secret, found := strings.Cut(entry, ":")
+		if !found || kid == "" {
+			return nil, fmt.Errorf("jwt key %q must be written as kid:secret", entry)
+		}
+		if len(secret) < MinKeyLength {
+			return nil, fmt.Errorf("jwt key %q must be at least %d bytes long", kid, MinKeyLength)
+		}
+		if _, exists := set.keys[kid]; exists {
+			return nil, fmt.Errorf("jwt key %q is listed twice", kid)
+		}
+		set.keys[kid] = []byte(secret)
+		if set.signingKID == "" {
+			set.signingKID = kid
+		}
+	}
+
+	if set.signingKID == "" {
+		return nil, errors.New("at least one jwt key is required")
+	}
+	return set, nil
+}
+
+// Sign returns the signed token for claims, the issuer is filled in from the key set
+func (k *KeySet) Sign(claims Claims) (string, error) {
+	claims.Issuer = k.issuer
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = k.signingKID
+	return token.SignedString(k.keys[k.signingKID])
+}
+
+// Verify checks the signature, issuer and expiry of a token and returns its claims
+func (k *KeySet) Verify(tokenString string) (*Claims, error) {
+	var claims Claims
+	_, err := jwt.ParseWithClaims(tokenString, &claims, k.keyFor,
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithIssuer(k.issuer),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(5*time.Second),
+	)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	if claims.ID == "" {
+		return nil, ErrInvalidToken
+	}
+	if _, err := claims.UserID(); err != nil {
+		return nil, err
+	}
+	return &claims, nil
+}
+
+func (k *KeySet) keyFor(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := k.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	return key, nil
+}
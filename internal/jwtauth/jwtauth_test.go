@@ -0,0 +1,144 @@
+package jwtauth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	currentKey = "current-secret-that-is-long-enough-0000"
+	retiredKey = "retired-secret-that-is-long-enough-0000"
+)
+
+func TestParseKeySet(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		wantErr bool
+	}{
+		{"single key", "a:" + currentKey, false},
+		{"rotation", "new:" + currentKey + ", old:" + retiredKey, false},
+		{"blank entries", ",a:" + currentKey + ",", false},
+		{"empty", "", true},
+		{"no colon", currentKey, true},
+		{"no kid", ":" + currentKey, true},
+		{"short secret", "a:short", true},
+		{"listed twice", "a:" + currentKey + ",a:" + retiredKey, true},
+	}
+	for _, tt := range tests {
+		_, err := ParseKeySet(tt.spec, "book-club")
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: err = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func validClaims() Claims {
+	now := time.Now()
+	return Claims{
+		Username:    "alice",
+		Activated:   true,
+		Permissions: []string{"books:read"},
+		SessionID:   7,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        "token-hash",
+			Subject:   "42",
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+		},
+	}
+}
+
+func mustKeySet(t *testing.T, spec, issuer string) *KeySet {
+	t.Helper()
+	keys, err := ParseKeySet(spec, issuer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
+
+func TestSignAndVerify(t *testing.T) {
+	keys := mustKeySet(t, "new:"+currentKey+",old:"+retiredKey, "book-club")
+
+	signed, err := keys.Sign(validClaims())
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := keys.Verify(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	userID, _ := claims.UserID()
+	if userID != 42 || claims.Username != "alice" || claims.SessionID != 7 || claims.Issuer != "book-club" {
+		t.Errorf("got claims %+v", claims)
+	}
+
+	token, _, err := jwt.NewParser().ParseUnverified(signed, &Claims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kid := token.Header["kid"]; kid != "new" {
+		t.Errorf("signed with kid %v, want new", kid)
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	keys := mustKeySet(t, "new:"+currentKey+",old:"+retiredKey, "book-club")
+	retired := mustKeySet(t, "old:"+retiredKey, "book-club")
+	unknown := mustKeySet(t, "other:"+currentKey, "book-club")
+	otherIssuer := mustKeySet(t, "new:"+currentKey, "someone-else")
+
+	sign := func(t *testing.T, signer *KeySet, change func(*Claims)) string {
+		t.Helper()
+		claims := validClaims()
+		if change != nil {
+			change(&claims)
+		}
+		signed, err := signer.Sign(claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+
+	unsigned, err := jwt.NewWithClaims(jwt.SigningMethodNone, validClaims()).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	valid := sign(t, keys, nil)
+	tampered := valid[:strings.LastIndex(valid, ".")+1] + "AAAA"
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{"retired key still verifies", sign(t, retired, nil), false},
+		{"unknown kid", sign(t, unknown, nil), true},
+		{"wrong issuer", sign(t, otherIssuer, nil), true},
+		{"tampered signature", tampered, true},
+		{"alg none", unsigned, true},
+		{"expired", sign(t, keys, func(c *Claims) {
+			c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+		}), true},
+		{"no expiry", sign(t, keys, func(c *Claims) { c.ExpiresAt = nil }), true},
+		{"no jti", sign(t, keys, func(c *Claims) { c.ID = "" }), true},
+		{"subject not a number", sign(t, keys, func(c *Claims) { c.Subject = "alice" }), true},
+		{"subject not positive", sign(t, keys, func(c *Claims) { c.Subject = "0" }), true},
+		{"garbage", "not.a.token", true},
+	}
+	for _, tt := range tests {
+		_, err := keys.Verify(tt.token)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: err = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+		if err != nil && !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%s: err = %v, want ErrInvalidToken", tt.name, err)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package markdown
+
+import (
+	"bytes"
+	"html"
+	"regexp"
+	"strings"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+)
+
+// Spoilers are written as a fenced block, the text after ":::spoiler" is an optional label
+//
+//	:::spoiler The ending
+//	Everyone was a ghost the whole time.
+//	:::
+//
+// and are rendered as <details class="spoiler"> so clients can collapse them.
+const (
+	spoilerOpen  = ":::spoiler"
+	spoilerClose = ":::"
+)
+
+var converter = goldmark.New(goldmark.WithExtensions(extension.Strikethrough, extension.Linkify))
+
+// policy is the user generated content policy plus the spoiler markup; it removes scripts,
+// event handler attributes and links that are not http, https or mailto
+var policy = func() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	p.AllowURLSchemes("http", "https", "mailto")
+	p.AllowElements("details", "summary")
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^spoiler$`)).OnElements("details")
+	return p
+}()
+
+// Render converts Markdown source into sanitized HTML
+func Render(source string) (string, error) {
+	var out bytes.Buffer
+	var segment []string
+	inSpoiler := false
+	label := ""
+
+	flush := func() error {
+		text := strings.Join(segment, "\n")
+		segment = segment[:0]
+		if !inSpoiler {
+			return converter.Convert([]byte(text), &out)
+		}
+		out.WriteString(`<details class="spoiler"><summary>` + html.EscapeString(label) + "</summary>\n")
+		err := converter.Convert([]byte(text), &out)
+		out.WriteString("</details>\n")
+		return err
+	}
+
+	for _, line := range strings.Split(strings.ReplaceAll(source, "\r\n", "\n"), "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case !inSpoiler && strings.HasPrefix(trimmed, spoilerOpen):
+			if err := flush(); err != nil {
+				return "", err
+			}
+			inSpoiler = true
+			label = strings.TrimSpace(strings.TrimPrefix(trimmed, spoilerOpen))
+			if label == "" {
+				label = "Spoiler"
+			}
+		case inSpoiler && trimmed == spoilerClose:
+			if err := flush(); err != nil {
+				return "", err
+			}
+			inSpoiler = false
+		default:
+			segment = append(segment, line)
+		}
+	}
+	// an unclosed spoiler runs to the end of the review
+	if err := flush(); err != nil {
+		return "", err
+	}
+
+	return policy.Sanitize(out.String()), nil
+}
@@ -0,0 +1,96 @@
+package markdown
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		contains []string
+		excludes []string
+	}{
+		{
+			name:     "emphasis",
+			source:   "a **great** _book_",
+			contains: []string{"<strong>great</strong>", "<em>book</em>"},
+		},
+		{
+			name:     "strikethrough",
+			source:   "~~boring~~",
+			contains: []string{"<del>boring</del>"},
+		},
+		{
+			name:     "bare links are linked",
+			source:   "see https://example.com",
+			contains: []string{`<a href="https://example.com"`},
+		},
+		{
+			name:     "script removed",
+			source:   "hi <script>alert(1)</script>",
+			excludes: []string{"<script", "alert(1)</script>"},
+		},
+		{
+			name:     "event handlers removed",
+			source:   `<img src="x.png" onerror="alert(1)">`,
+			excludes: []string{"onerror"},
+		},
+		{
+			name:     "javascript links removed",
+			source:   "[click](javascript:alert(1))",
+			excludes: []string{"javascript:"},
+		},
+		{
+			name:     "spoiler with label",
+			source:   ":::spoiler The ending\nEveryone was a ghost.\n:::",
+			contains: []string{`<details class="spoiler">`, "<summary>The ending</summary>", "Everyone was a ghost."},
+		},
+		{
+			name:     "spoiler without label",
+			source:   ":::spoiler\nsecret\n:::",
+			contains: []string{"<summary>Spoiler</summary>"},
+		},
+		{
+			name:     "spoiler label escaped",
+			source:   ":::spoiler <b onclick=x>hi</b>\nsecret\n:::",
+			contains: []string{"<summary>&lt;b onclick=x&gt;hi&lt;/b&gt;</summary>"},
+			excludes: []string{"<b onclick"},
+		},
+		{
+			name:     "unclosed spoiler runs to the end",
+			source:   "before\n:::spoiler\nhidden",
+			contains: []string{"<p>before</p>", `<details class="spoiler">`, "hidden"},
+		},
+		{
+			name:     "windows line endings",
+			source:   ":::spoiler\r\nsecret\r\n:::\r\nafter",
+			contains: []string{"</details>", "<p>after</p>"},
+		},
+		{
+			name:     "other class names dropped",
+			source:   `<details class="evil">x</details>`,
+			excludes: []string{`class="evil"`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Render(tt.source)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range tt.contains {
+				if !strings.Contains(got, want) {
+					t.Errorf("missing %q in %q", want, got)
+				}
+			}
+			for _, unwanted := range tt.excludes {
+				if strings.Contains(got, unwanted) {
+					t.Errorf("unexpected %q in %q", unwanted, got)
+				}
+			}
+		})
+	}
+}
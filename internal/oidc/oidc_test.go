@@ -0,0 +1,143 @@
+package oidc_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/luigiacunaUB/cmps4191-test-3/internal/oidc"
+	"github.com/luigiacunaUB/cmps4191-test-3/internal/oidc/oidctest"
+)
+
+func newProvider(t *testing.T, server *oidctest.Server) *oidc.Provider {
+	t.Helper()
+	provider, err := oidc.New(oidc.Config{
+		IssuerURL:   server.URL,
+		ClientID:    oidctest.ClientID,
+		RedirectURL: "http://localhost:4000/v1/oidc/callback",
+		Scopes:      []string{"email", "profile"},
+		HTTPClient:  server.Client(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return provider
+}
+
+func TestExchange(t *testing.T) {
+	server, err := oidctest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	provider := newProvider(t, server)
+
+	login := oidctest.IDToken{Subject: "user-1", Email: "alice@example.com", EmailVerified: true, PreferredUsername: "alice"}
+	tests := []struct {
+		name          string
+		token         oidctest.IDToken
+		wrongVerifier bool
+		wantErr       error
+	}{
+		{"valid", login, false, nil},
+		{"wrong nonce", withChange(login, func(token *oidctest.IDToken) { token.Nonce = "someone-elses-nonce" }), false, oidc.ErrInvalidIDToken},
+		{"wrong audience", withChange(login, func(token *oidctest.IDToken) { token.Audience = "another-client" }), false, oidc.ErrInvalidIDToken},
+		{"wrong issuer", withChange(login, func(token *oidctest.IDToken) { token.Issuer = "https://evil.example.com" }), false, oidc.ErrInvalidIDToken},
+		{"expired", withChange(login, func(token *oidctest.IDToken) { token.Expired = true }), false, oidc.ErrInvalidIDToken},
+		{"forged signature", withChange(login, func(token *oidctest.IDToken) { token.Forged = true }), false, oidc.ErrInvalidIDToken},
+		{"no subject", withChange(login, func(token *oidctest.IDToken) { token.Subject = "" }), false, oidc.ErrInvalidIDToken},
+		{"wrong PKCE verifier", login, true, oidc.ErrExchangeFailed},
+	}
+	for _, tt := range tests {
+		state, nonce, verifier := randomString(t), randomString(t), randomString(t)
+		authorizationURL, err := provider.AuthCodeURL(context.Background(), state, nonce, verifier)
+		if err != nil {
+			t.Fatal(err)
+		}
+		code, returnedState, err := server.Login(authorizationURL, tt.token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if returnedState != state {
+			t.Errorf("%s: state %q came back as %q", tt.name, state, returnedState)
+		}
+		if tt.wrongVerifier {
+			verifier = randomString(t)
+		}
+
+		claims, err := provider.Exchange(context.Background(), code, verifier, nonce)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr == nil && (claims.Subject != "user-1" || claims.Email != "alice@example.com" || !claims.EmailVerified || claims.PreferredUsername != "alice") {
+			t.Errorf("%s: got claims %+v", tt.name, claims)
+		}
+	}
+}
+
+func TestExchangeCodeWorksOnce(t *testing.T) {
+	server, err := oidctest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	provider := newProvider(t, server)
+
+	nonce, verifier := randomString(t), randomString(t)
+	authorizationURL, err := provider.AuthCodeURL(context.Background(), randomString(t), nonce, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _, err := server.Login(authorizationURL, oidctest.IDToken{Subject: "user-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = provider.Exchange(context.Background(), code, verifier, nonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = provider.Exchange(context.Background(), code, verifier, nonce)
+	if !errors.Is(err, oidc.ErrExchangeFailed) {
+		t.Errorf("second exchange: err = %v, want %v", err, oidc.ErrExchangeFailed)
+	}
+}
+
+func TestDiscoveryIssuerMismatch(t *testing.T) {
+	server, err := oidctest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	// The same server under another name, its document names a different issuer than the one configured
+	provider, err := oidc.New(oidc.Config{
+		IssuerURL:   strings.Replace(server.URL, "127.0.0.1", "localhost", 1),
+		ClientID:    oidctest.ClientID,
+		RedirectURL: "http://localhost:4000/v1/oidc/callback",
+		HTTPClient:  server.Client(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = provider.AuthCodeURL(context.Background(), "state", "nonce", "verifier")
+	if err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Errorf("err = %v, want the issuer mismatch refused", err)
+	}
+}
+
+func withChange(token oidctest.IDToken, change func(*oidctest.IDToken)) oidctest.IDToken {
+	change(&token)
+	return token
+}
+
+func randomString(t *testing.T) string {
+	t.Helper()
+	value, err := oidc.RandomString()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return value
+}
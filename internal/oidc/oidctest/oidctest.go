@@ -0,0 +1,203 @@
+// Package oidctest runs a fake OpenID Connect provider for tests. It serves discovery, its keys and a token
+// endpoint that checks the PKCE verifier, and hands out ID tokens that can be made invalid on purpose.
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ClientID is the client the provider expects
+const ClientID = "bookclub-test"
+
+// IDToken is what the provider says about the user logging in. The fields after PreferredUsername break the
+// token, their zero values give a valid one.
+type IDToken struct {
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	Name              string
+	PreferredUsername string
+
+	// Nonce replaces the nonce of the login
+	Nonce string
+	// Audience replaces ClientID
+	Audience string
+	// Issuer replaces the provider's issuer
+	Issuer string
+	// Expired gives the token an expiry in the past
+	Expired bool
+	// Forged signs the token with a key the provider doesn't publish
+	Forged bool
+}
+
+type login struct {
+	challenge string
+	nonce     string
+	token     IDToken
+}
+
+// Server is a running fake provider, its URL is the issuer
+type Server struct {
+	*httptest.Server
+
+	key       *rsa.PrivateKey
+	forgedKey *rsa.PrivateKey
+
+	mu     sync.Mutex
+	logins map[string]login
+}
+
+// NewServer starts a provider, close it when done
+func NewServer() (*Server, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	forgedKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{key: key, forgedKey: forgedKey, logins: make(map[string]login)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", s.discoveryHandler)
+	mux.HandleFunc("GET /keys", s.keysHandler)
+	mux.HandleFunc("POST /token", s.tokenHandler)
+	s.Server = httptest.NewServer(mux)
+	return s, nil
+}
+
+// Login plays the user signing in at the authorization URL the relying party built. It returns the code and
+// state the provider would send to the redirect URL.
+func (s *Server) Login(authorizationURL string, token IDToken) (string, string, error) {
+	parsed, err := url.Parse(authorizationURL)
+	if err != nil {
+		return "", "", err
+	}
+	query := parsed.Query()
+	if query.Get("client_id") != ClientID || query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		return "", "", errors.New("oidctest: the authorization URL is missing the client id or PKCE challenge")
+	}
+
+	code := randomString()
+	s.mu.Lock()
+	s.logins[code] = login{challenge: query.Get("code_challenge"), nonce: query.Get("nonce"), token: token}
+	s.mu.Unlock()
+	return code, query.Get("state"), nil
+}
+
+func (s *Server) discoveryHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{
+		"issuer":                 s.URL,
+		"authorization_endpoint": s.URL + "/authorize",
+		"token_endpoint":         s.URL + "/token",
+		"jwks_uri":               s.URL + "/keys",
+	})
+}
+
+func (s *Server) keysHandler(w http.ResponseWriter, r *http.Request) {
+	publicKey := s.key.PublicKey
+	writeJSON(w, http.StatusOK, map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"use": "sig",
+			"kid": "test",
+			"n":   base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes()),
+		}},
+	})
+}
+
+func (s *Server) tokenHandler(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	// A code works once, like at a real provider
+	s.mu.Lock()
+	current, ok := s.logins[r.PostForm.Get("code")]
+	delete(s.logins, r.PostForm.Get("code"))
+	s.mu.Unlock()
+
+	verifierHash := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || r.PostForm.Get("grant_type") != "authorization_code" || r.PostForm.Get("client_id") != ClientID ||
+		base64.RawURLEncoding.EncodeToString(verifierHash[:]) != current.challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	idToken, err := s.sign(current)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"id_token":     idToken,
+	})
+}
+
+func (s *Server) sign(current login) (string, error) {
+	token := current.token
+	claims := jwt.MapClaims{
+		"iss":                s.URL,
+		"sub":                token.Subject,
+		"aud":                ClientID,
+		"nonce":              current.nonce,
+		"iat":                time.Now().Unix(),
+		"exp":                time.Now().Add(5 * time.Minute).Unix(),
+		"email":              token.Email,
+		"email_verified":     token.EmailVerified,
+		"name":               token.Name,
+		"preferred_username": token.PreferredUsername,
+	}
+	if token.Nonce != "" {
+		claims["nonce"] = token.Nonce
+	}
+	if token.Audience != "" {
+		claims["aud"] = token.Audience
+	}
+	if token.Issuer != "" {
+		claims["iss"] = token.Issuer
+	}
+	if token.Expired {
+		claims["iat"] = time.Now().Add(-time.Hour).Unix()
+		claims["exp"] = time.Now().Add(-30 * time.Minute).Unix()
+	}
+
+	key := s.key
+	if token.Forged {
+		key = s.forgedKey
+	}
+	signed := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	signed.Header["kid"] = "test"
+	return signed.SignedString(key)
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func randomString() string {
+	randomBytes := make([]byte, 16)
+	rand.Read(randomBytes)
+	return base64.RawURLEncoding.EncodeToString(randomBytes)
+}
@@ -0,0 +1,121 @@
+package totp
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA1 key of the RFC 6238 test vectors, "12345678901234567890" in base32
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCode(t *testing.T) {
+	// The RFC lists eight digit codes, six digit ones are their last six digits
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		got, err := Code(rfcSecret, Step(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("Code at %d = %q, want %q", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestCodeInvalidSecret(t *testing.T) {
+	for _, secret := range []string{"", "not base32!", "A"} {
+		_, err := Code(secret, 1)
+		if !errors.Is(err, ErrInvalidSecret) {
+			t.Errorf("Code(%q) err = %v, want ErrInvalidSecret", secret, err)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step := Step(now)
+	codeAt := func(step int64) string {
+		code, err := Code(rfcSecret, step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return code
+	}
+
+	tests := []struct {
+		name     string
+		secret   string
+		code     string
+		wantStep int64
+		wantOK   bool
+	}{
+		{"current step", rfcSecret, codeAt(step), step, true},
+		{"previous step", rfcSecret, codeAt(step - 1), step - 1, true},
+		{"next step", rfcSecret, codeAt(step + 1), step + 1, true},
+		{"outside the skew", rfcSecret, codeAt(step - 2), 0, false},
+		{"spaces typed along", rfcSecret, " 050 471 ", step, true},
+		{"lowercase secret", strings.ToLower(rfcSecret), codeAt(step), step, true},
+		{"wrong code", rfcSecret, "000000", 0, false},
+		{"too short", rfcSecret, "05047", 0, false},
+		{"too long", rfcSecret, "0504711", 0, false},
+		{"invalid secret", "not base32!", codeAt(step), 0, false},
+	}
+	for _, tt := range tests {
+		gotStep, ok := Validate(tt.secret, tt.code, now)
+		if ok != tt.wantOK || gotStep != tt.wantStep {
+			t.Errorf("%s: Validate = (%d, %v), want (%d, %v)", tt.name, gotStep, ok, tt.wantStep, tt.wantOK)
+		}
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := encoding.DecodeString(secret)
+	if err != nil || len(key) != 20 {
+		t.Errorf("secret %q decodes to %d bytes (%v), want 20", secret, len(key), err)
+	}
+
+	other, _ := GenerateSecret()
+	if other == secret {
+		t.Error("two secrets are the same")
+	}
+}
+
+func TestURI(t *testing.T) {
+	uri := URI("Book Club", "alice@example.com", rfcSecret)
+
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Scheme != "otpauth" || parsed.Host != "totp" || parsed.Path != "/Book Club:alice@example.com" {
+		t.Errorf("uri %q has the wrong label", uri)
+	}
+	if strings.Contains(uri, "+") {
+		t.Errorf("uri %q encodes spaces as +", uri)
+	}
+
+	query := parsed.Query()
+	want := map[string]string{"secret": rfcSecret, "issuer": "Book Club", "algorithm": "SHA1", "digits": "6", "period": "30"}
+	for key, value := range want {
+		if query.Get(key) != value {
+			t.Errorf("%s = %q, want %q", key, query.Get(key), value)
+		}
+	}
+}
@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN reviews_private bool NOT NULL DEFAULT false;
@@ -0,0 +1,7 @@
+DELETE FROM users_permissions
+WHERE permission_id = (SELECT id FROM permissions WHERE code = 'reviews:moderate');
+
+DELETE FROM permissions
+WHERE code = 'reviews:moderate';
+
+DROP TABLE IF EXISTS review_revisions;
@@ -0,0 +1,15 @@
+-- Earlier versions of a review, written each time the review is updated
+CREATE TABLE IF NOT EXISTS review_revisions (
+    id bigserial PRIMARY KEY,
+    review_id INT NOT NULL REFERENCES reviews(id) ON DELETE CASCADE, -- Review this version belongs to
+    rating INT NOT NULL CHECK (rating BETWEEN 1 AND 5),              -- Rating at the time
+    review TEXT NOT NULL,                                           -- Text at the time
+    written_at TIMESTAMP NOT NULL,                                  -- When this version was written
+    replaced_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP        -- When it was replaced by an edit
+);
+
+CREATE INDEX IF NOT EXISTS review_revisions_review_id_idx ON review_revisions (review_id);
+
+-- Moderators can see the edit history of any review
+INSERT INTO permissions (code)
+VALUES ('reviews:moderate');
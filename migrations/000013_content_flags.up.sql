@@ -0,0 +1,11 @@
+-- User submitted text that a content filter flagged for moderation
+CREATE TABLE IF NOT EXISTS content_flags (
+    id bigserial PRIMARY KEY,
+    content_type text NOT NULL,                                 -- 'review', 'reading_list', ...
+    content_id bigint NOT NULL,                                 -- id of the flagged row
+    reasons text[] NOT NULL,                                    -- why the filters flagged it
+    resolved bool NOT NULL DEFAULT false,                       -- set once a moderator has looked at it
+    created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS content_flags_open_idx ON content_flags (created_at) WHERE NOT resolved;
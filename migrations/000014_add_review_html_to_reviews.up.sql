@@ -0,0 +1,6 @@
+-- Rendered and sanitized HTML for the Markdown in reviews.review
+ALTER TABLE reviews ADD COLUMN review_html TEXT NOT NULL DEFAULT '';
+
+-- Existing reviews are short plain text, so they are escaped into a single paragraph
+UPDATE reviews
+SET review_html = '<p>' || replace(replace(replace(review, '&', '&amp;'), '<', '&lt;'), '>', '&gt;') || '</p>';
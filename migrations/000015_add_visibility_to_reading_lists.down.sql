@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS reading_lists_created_by_idx;
+
+ALTER TABLE reading_lists DROP COLUMN IF EXISTS visibility;
@@ -0,0 +1,6 @@
+-- Who can see a reading list: everyone, only the owner, or anyone with the link
+ALTER TABLE reading_lists
+ADD COLUMN visibility VARCHAR(10) NOT NULL DEFAULT 'public'
+CHECK (visibility IN ('public', 'private', 'unlisted'));
+
+CREATE INDEX IF NOT EXISTS reading_lists_created_by_idx ON reading_lists (created_by);
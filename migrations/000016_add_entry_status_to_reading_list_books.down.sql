@@ -0,0 +1,6 @@
+ALTER TABLE reading_list_books
+    DROP COLUMN IF EXISTS finished_at,
+    DROP COLUMN IF EXISTS started_at,
+    DROP COLUMN IF EXISTS progress_percent,
+    DROP COLUMN IF EXISTS current_page,
+    DROP COLUMN IF EXISTS status;
@@ -0,0 +1,14 @@
+-- Every book on a reading list carries its own reading state
+ALTER TABLE reading_list_books
+    ADD COLUMN status VARCHAR(20) NOT NULL DEFAULT 'want to read'
+        CHECK (status IN ('want to read', 'reading', 'finished', 'abandoned')),
+    ADD COLUMN current_page INT CHECK (current_page >= 0),
+    ADD COLUMN progress_percent NUMERIC(5, 2) CHECK (progress_percent BETWEEN 0 AND 100),
+    ADD COLUMN started_at TIMESTAMP,
+    ADD COLUMN finished_at TIMESTAMP;
+
+-- Books on lists that were already marked completed count as finished
+UPDATE reading_list_books rb
+SET status = 'finished', finished_at = r.updated_at
+FROM reading_lists r
+WHERE r.id = rb.reading_list_id AND r.status = 'completed';
@@ -0,0 +1,3 @@
+ALTER TABLE reading_list_books DROP CONSTRAINT IF EXISTS reading_list_books_position_key;
+
+ALTER TABLE reading_list_books DROP COLUMN IF EXISTS position;
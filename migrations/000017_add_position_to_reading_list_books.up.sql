@@ -0,0 +1,19 @@
+-- Explicit order of the books on a reading list, starting at 1
+ALTER TABLE reading_list_books ADD COLUMN position INT;
+
+-- Existing lists keep the order they were shown in so far
+UPDATE reading_list_books rb
+SET position = ordered.position
+FROM (
+    SELECT reading_list_id, book_id,
+           ROW_NUMBER() OVER (PARTITION BY reading_list_id ORDER BY book_id) AS position
+    FROM reading_list_books
+) ordered
+WHERE rb.reading_list_id = ordered.reading_list_id AND rb.book_id = ordered.book_id;
+
+ALTER TABLE reading_list_books ALTER COLUMN position SET NOT NULL;
+
+-- Deferred so a whole list can be renumbered inside one transaction
+ALTER TABLE reading_list_books
+ADD CONSTRAINT reading_list_books_position_key UNIQUE (reading_list_id, position)
+DEFERRABLE INITIALLY DEFERRED;
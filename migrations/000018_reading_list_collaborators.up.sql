@@ -0,0 +1,10 @@
+-- Users a reading list has been shared with; viewers can see the list, editors can also change its books
+CREATE TABLE IF NOT EXISTS reading_list_collaborators (
+    reading_list_id INT NOT NULL REFERENCES reading_lists(id) ON DELETE CASCADE,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role VARCHAR(10) NOT NULL CHECK (role IN ('viewer', 'editor')),
+    added_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (reading_list_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS reading_list_collaborators_user_id_idx ON reading_list_collaborators (user_id);
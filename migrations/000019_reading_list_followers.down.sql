@@ -0,0 +1,3 @@
+ALTER TABLE users DROP COLUMN IF EXISTS notify_list_updates;
+
+DROP TABLE IF EXISTS reading_list_followers;
@@ -0,0 +1,12 @@
+-- Users following a reading list to hear about new books on it
+CREATE TABLE IF NOT EXISTS reading_list_followers (
+    reading_list_id INT NOT NULL REFERENCES reading_lists(id) ON DELETE CASCADE,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    followed_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (reading_list_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS reading_list_followers_user_id_idx ON reading_list_followers (user_id);
+
+-- Users can turn off the emails sent when a followed list changes
+ALTER TABLE users ADD COLUMN IF NOT EXISTS notify_list_updates BOOLEAN NOT NULL DEFAULT TRUE;
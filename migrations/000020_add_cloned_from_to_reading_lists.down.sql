@@ -0,0 +1 @@
+ALTER TABLE reading_lists DROP COLUMN IF EXISTS cloned_from;
@@ -0,0 +1,5 @@
+-- The list a reading list was cloned from, kept as NULL when the original is deleted
+ALTER TABLE reading_lists
+ADD COLUMN IF NOT EXISTS cloned_from INT REFERENCES reading_lists(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS reading_lists_cloned_from_idx ON reading_lists (cloned_from);
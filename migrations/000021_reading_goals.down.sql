@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS reading_list_books_finished_at_idx;
+
+DROP TABLE IF EXISTS reading_goals;
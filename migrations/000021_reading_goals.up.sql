@@ -0,0 +1,13 @@
+-- A user's target number of books for a year, progress is worked out from finished entries and reviews
+CREATE TABLE IF NOT EXISTS reading_goals (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    year INT NOT NULL,
+    target INT NOT NULL CHECK (target > 0),
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    version INT NOT NULL DEFAULT 1,
+    UNIQUE (user_id, year)
+);
+
+-- Stats look up finished entries by date
+CREATE INDEX IF NOT EXISTS reading_list_books_finished_at_idx ON reading_list_books (finished_at) WHERE finished_at IS NOT NULL;
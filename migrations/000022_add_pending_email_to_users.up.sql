@@ -0,0 +1,2 @@
+-- A new email address waiting to be confirmed, the account keeps using email until then
+ALTER TABLE users ADD COLUMN IF NOT EXISTS pending_email citext;
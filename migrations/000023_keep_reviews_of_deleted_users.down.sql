@@ -0,0 +1,14 @@
+-- Reviews kept from deleted accounts have no author the old NOT NULL column could hold, so rolling back
+-- refuses to run rather than delete them
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM reviews WHERE user_id IS NULL) THEN
+        RAISE EXCEPTION 'reviews of deleted users exist, delete or reassign them before rolling back';
+    END IF;
+END
+$$;
+
+ALTER TABLE reviews DROP CONSTRAINT IF EXISTS reviews_user_id_fkey;
+ALTER TABLE reviews ADD CONSTRAINT reviews_user_id_fkey
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+ALTER TABLE reviews ALTER COLUMN user_id SET NOT NULL;
@@ -0,0 +1,5 @@
+-- Reviews can outlive their author, a deleted account leaves its kept reviews without a user
+ALTER TABLE reviews ALTER COLUMN user_id DROP NOT NULL;
+ALTER TABLE reviews DROP CONSTRAINT IF EXISTS reviews_user_id_fkey;
+ALTER TABLE reviews ADD CONSTRAINT reviews_user_id_fkey
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL;
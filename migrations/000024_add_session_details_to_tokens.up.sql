@@ -0,0 +1,8 @@
+-- Authentication tokens double as sessions the user can list and revoke one at a time
+ALTER TABLE tokens ADD COLUMN IF NOT EXISTS id bigserial UNIQUE;
+ALTER TABLE tokens ADD COLUMN IF NOT EXISTS created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW();
+ALTER TABLE tokens ADD COLUMN IF NOT EXISTS last_used_at timestamp(0) WITH TIME ZONE; -- NULL until the token is first used
+ALTER TABLE tokens ADD COLUMN IF NOT EXISTS ip_address text;                          -- where the token was last used from
+ALTER TABLE tokens ADD COLUMN IF NOT EXISTS user_agent text;                          -- client that logged in
+
+CREATE INDEX IF NOT EXISTS tokens_user_id_scope_idx ON tokens (user_id, scope);
@@ -0,0 +1,11 @@
+-- A token family is one login: the access and refresh tokens issued for it and every refresh
+-- token it has rotated through. Revoking a session deletes the whole family.
+CREATE SEQUENCE IF NOT EXISTS token_families_seq;
+
+ALTER TABLE tokens ADD COLUMN IF NOT EXISTS family_id bigint;
+ALTER TABLE tokens ADD COLUMN IF NOT EXISTS used_at timestamp(0) WITH TIME ZONE; -- set once a refresh token has been exchanged
+
+-- Authentication tokens issued before families existed become a family of their own
+UPDATE tokens SET family_id = nextval('token_families_seq') WHERE scope = 'authentication' AND family_id IS NULL;
+
+CREATE INDEX IF NOT EXISTS tokens_family_id_idx ON tokens (family_id);
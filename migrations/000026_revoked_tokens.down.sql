@@ -0,0 +1,4 @@
+DROP TRIGGER IF EXISTS revoke_deleted_access_token ON tokens;
+DROP FUNCTION IF EXISTS revoke_deleted_access_token();
+
+DROP TABLE IF EXISTS revoked_tokens;
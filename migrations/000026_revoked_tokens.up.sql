@@ -0,0 +1,27 @@
+-- Access tokens revoked before they expire. Stateless JWT access tokens can't be deleted, so they are
+-- refused while their hash is listed here. Rows are useless once expiry has passed.
+CREATE TABLE IF NOT EXISTS revoked_tokens (
+    hash bytea PRIMARY KEY,
+    expiry timestamp(0) WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS revoked_tokens_expiry_idx ON revoked_tokens (expiry);
+
+-- Every way an unexpired access token can disappear (logout, revoking sessions, refresh token reuse,
+-- deleting the user) ends in a DELETE on tokens, so the denylist is kept by a trigger
+CREATE OR REPLACE FUNCTION revoke_deleted_access_token()
+RETURNS TRIGGER AS $$
+BEGIN
+    DELETE FROM revoked_tokens WHERE expiry <= NOW();
+    INSERT INTO revoked_tokens (hash, expiry)
+    VALUES (OLD.hash, OLD.expiry)
+    ON CONFLICT (hash) DO NOTHING;
+    RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER revoke_deleted_access_token
+AFTER DELETE ON tokens
+FOR EACH ROW
+WHEN (OLD.scope = 'authentication' AND OLD.expiry > NOW())
+EXECUTE FUNCTION revoke_deleted_access_token();
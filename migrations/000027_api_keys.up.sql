@@ -0,0 +1,14 @@
+-- Long-lived keys for scripts and service accounts, sent as "Authorization: ApiKey <key>"
+CREATE TABLE IF NOT EXISTS api_keys (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    name text NOT NULL,
+    prefix text NOT NULL,                                         -- start of the key, shown so keys can be told apart
+    hash bytea UNIQUE NOT NULL,
+    permissions text[] NOT NULL,                                  -- subset of the owner's permissions the key may use
+    created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    expires_at timestamp(0) WITH TIME ZONE,                       -- NULL keys never expire
+    last_used_at timestamp(0) WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS api_keys_user_id_idx ON api_keys (user_id);
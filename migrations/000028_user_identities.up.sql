@@ -0,0 +1,20 @@
+-- Accounts at an external OpenID Connect provider linked to users, found by the provider's issuer and subject
+CREATE TABLE IF NOT EXISTS user_identities (
+    issuer text NOT NULL,
+    subject text NOT NULL,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    email citext,                                                  -- address the provider reported at the last login
+    created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    last_login_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (issuer, subject)
+);
+
+CREATE INDEX IF NOT EXISTS user_identities_user_id_idx ON user_identities (user_id);
+
+-- Logins in progress: the PKCE verifier and nonce wait here between the redirect to the provider and the callback
+CREATE TABLE IF NOT EXISTS oidc_login_states (
+    state_hash bytea PRIMARY KEY,
+    code_verifier text NOT NULL,
+    nonce text NOT NULL,
+    expiry timestamp(0) WITH TIME ZONE NOT NULL
+);
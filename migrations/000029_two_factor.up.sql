@@ -0,0 +1,16 @@
+-- TOTP two-factor authentication, the secret is only in use once enabled_at is set
+CREATE TABLE IF NOT EXISTS user_totp (
+    user_id bigint PRIMARY KEY REFERENCES users ON DELETE CASCADE,
+    secret text NOT NULL,
+    created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    enabled_at timestamp(0) WITH TIME ZONE,                       -- NULL while enrollment is unconfirmed
+    last_used_step bigint NOT NULL DEFAULT 0                      -- time step of the last accepted code, so codes work once
+);
+
+-- One-time codes for when the authenticator is lost
+CREATE TABLE IF NOT EXISTS totp_recovery_codes (
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    hash bytea NOT NULL,
+    used_at timestamp(0) WITH TIME ZONE,
+    PRIMARY KEY (user_id, hash)
+);
@@ -0,0 +1,10 @@
+-- Invitations to collaborate on a reading list. They are kept by email address so that inviting someone
+-- doesn't reveal whether the address has an account; the invitee accepts once logged in with it.
+CREATE TABLE IF NOT EXISTS reading_list_invitations (
+    reading_list_id INT NOT NULL REFERENCES reading_lists(id) ON DELETE CASCADE,
+    email citext NOT NULL,
+    role VARCHAR(10) NOT NULL CHECK (role IN ('viewer', 'editor')),
+    invited_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    expiry TIMESTAMP(0) WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (reading_list_id, email)
+);
@@ -0,0 +1,4 @@
+-- Wrong codes are counted so a second factor can't be guessed through a stream of fresh challenges
+ALTER TABLE user_totp
+    ADD COLUMN IF NOT EXISTS failed_attempts integer NOT NULL DEFAULT 0,  -- wrong codes since the last right one
+    ADD COLUMN IF NOT EXISTS locked_until timestamp(0) WITH TIME ZONE;     -- codes are refused until then
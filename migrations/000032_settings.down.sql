@@ -0,0 +1,7 @@
+DELETE FROM users_permissions
+WHERE permission_id = (SELECT id FROM permissions WHERE code = 'settings:manage');
+
+DELETE FROM permissions
+WHERE code = 'settings:manage';
+
+DROP TABLE IF EXISTS settings;
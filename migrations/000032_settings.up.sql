@@ -0,0 +1,14 @@
+-- Site wide settings admins change through the API, the table holds a single row
+CREATE TABLE IF NOT EXISTS settings (
+    id boolean PRIMARY KEY DEFAULT TRUE CHECK (id),
+    require_2fa_for_writers boolean NOT NULL DEFAULT FALSE,  -- refuse write requests from users without 2FA
+    updated_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    version integer NOT NULL DEFAULT 1
+);
+
+INSERT INTO settings DEFAULT VALUES
+ON CONFLICT DO NOTHING;
+
+-- Admins can view and change the settings
+INSERT INTO permissions (code)
+VALUES ('settings:manage');